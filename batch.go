@@ -0,0 +1,119 @@
+package viettelpay
+
+// BatchStatus is the status of a disbursement batch, as reported by the
+// batchErrorCode of QueryRequests.
+//
+// A batch starts as BatchPending once RequestDisbursement is accepted, and
+// moves to BatchDisbursing while Viettel pays the transactions. From there
+// it ends as BatchSucceeded, BatchFailed or BatchTimedOut. A pending batch
+// may also be BatchCancelled, or fail or time out before it is disbursed.
+// Final statuses never change.
+type BatchStatus int
+
+const (
+	// BatchUnknown is used when no or an unknown batch code is returned.
+	BatchUnknown BatchStatus = iota
+	// BatchPending is WAIT_DISB: the batch is waiting to be disbursed.
+	BatchPending
+	// BatchDisbursing is DISBURSEMENT: the batch is being disbursed.
+	BatchDisbursing
+	// BatchSucceeded is DISB_SUCCESS: the batch was disbursed.
+	BatchSucceeded
+	// BatchFailed is DISB_FAILED: the batch could not be disbursed.
+	BatchFailed
+	// BatchCancelled is CANCEL_DISB: the batch was cancelled.
+	BatchCancelled
+	// BatchTimedOut is DISB_TIMEOUT: the batch was not disbursed in time.
+	BatchTimedOut
+)
+
+var batchStatusErrors = map[BatchStatus]*BatchError{
+	BatchPending:    ErrBatchWaitDisb,
+	BatchDisbursing: ErrBatchDisbursement,
+	BatchSucceeded:  ErrBatchDisbSuccess,
+	BatchFailed:     ErrBatchDisbFailed,
+	BatchCancelled:  ErrBatchCancelDisb,
+	BatchTimedOut:   ErrBatchDisbTimeout,
+}
+
+var batchTransitions = map[BatchStatus][]BatchStatus{
+	BatchPending:    {BatchDisbursing, BatchSucceeded, BatchFailed, BatchCancelled, BatchTimedOut},
+	BatchDisbursing: {BatchSucceeded, BatchFailed, BatchTimedOut},
+}
+
+// ParseBatchStatus returns the BatchStatus of a batch code such as
+// WAIT_DISB, or BatchUnknown.
+func ParseBatchStatus(code string) BatchStatus {
+	for s, e := range batchStatusErrors {
+		if e.Code == code {
+			return s
+		}
+	}
+
+	return BatchUnknown
+}
+
+// Code returns the batch code of the status, or an empty string for
+// BatchUnknown.
+func (s BatchStatus) Code() string {
+	if e, ok := batchStatusErrors[s]; ok {
+		return e.Code
+	}
+	return ""
+}
+
+// Err returns the *BatchError sentinel of the status, or nil for
+// BatchUnknown.
+func (s BatchStatus) Err() error {
+	if e, ok := batchStatusErrors[s]; ok {
+		return e
+	}
+	return nil
+}
+
+// IsFinal reports whether the batch will not change status anymore.
+func (s BatchStatus) IsFinal() bool {
+	switch s {
+	case BatchSucceeded, BatchFailed, BatchCancelled, BatchTimedOut:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether a batch may move from s to next.
+// BatchUnknown may move to any status.
+func (s BatchStatus) CanTransitionTo(next BatchStatus) bool {
+	if s == BatchUnknown || s == next {
+		return true
+	}
+	for _, t := range batchTransitions[s] {
+		if t == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s BatchStatus) String() string {
+	switch s {
+	case BatchPending:
+		return "Pending"
+	case BatchDisbursing:
+		return "Disbursing"
+	case BatchSucceeded:
+		return "Succeeded"
+	case BatchFailed:
+		return "Failed"
+	case BatchCancelled:
+		return "Cancelled"
+	case BatchTimedOut:
+		return "TimedOut"
+	}
+	return "Unknown"
+}
+
+// Status returns the BatchStatus carried by the error.
+func (e BatchError) Status() BatchStatus {
+	return ParseBatchStatus(e.Code)
+}
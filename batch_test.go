@@ -0,0 +1,47 @@
+package viettelpay_test
+
+import (
+	"errors"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchStatus(t *testing.T) {
+	tests := []struct {
+		code  string
+		want  viettelpay.BatchStatus
+		final bool
+	}{
+		{code: "WAIT_DISB", want: viettelpay.BatchPending},
+		{code: "DISBURSEMENT", want: viettelpay.BatchDisbursing},
+		{code: "DISB_SUCCESS", want: viettelpay.BatchSucceeded, final: true},
+		{code: "DISB_FAILED", want: viettelpay.BatchFailed, final: true},
+		{code: "CANCEL_DISB", want: viettelpay.BatchCancelled, final: true},
+		{code: "DISB_TIMEOUT", want: viettelpay.BatchTimedOut, final: true},
+		{code: "", want: viettelpay.BatchUnknown},
+		{code: "OTHER", want: viettelpay.BatchUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got := viettelpay.ParseBatchStatus(tt.code)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.final, got.IsFinal())
+			if tt.want != viettelpay.BatchUnknown {
+				assert.Equal(t, tt.code, got.Code())
+				assert.True(t, errors.Is(got.Err(), &viettelpay.BatchError{Code: tt.code}))
+			} else {
+				assert.NoError(t, got.Err())
+			}
+		})
+	}
+}
+
+func TestBatchStatus_CanTransitionTo(t *testing.T) {
+	assert.True(t, viettelpay.BatchPending.CanTransitionTo(viettelpay.BatchDisbursing))
+	assert.True(t, viettelpay.BatchPending.CanTransitionTo(viettelpay.BatchCancelled))
+	assert.True(t, viettelpay.BatchDisbursing.CanTransitionTo(viettelpay.BatchSucceeded))
+	assert.False(t, viettelpay.BatchDisbursing.CanTransitionTo(viettelpay.BatchPending))
+	assert.False(t, viettelpay.BatchSucceeded.CanTransitionTo(viettelpay.BatchFailed))
+}
@@ -0,0 +1,134 @@
+package viettelpay
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// MaxCheckAccountsPerRequest is the largest number of accounts checked by
+// one CheckAccount call of CheckAccounts, and its default. It is a bound set
+// by this package, not a limit quoted from the partner specification, which
+// the package does not carry; lower it with WithChunkSize if Viettel rejects
+// requests of that size.
+const MaxCheckAccountsPerRequest = 100
+
+// CheckAccountResult is the result of an account checked by CheckAccounts.
+type CheckAccountResult struct {
+	CheckAccountResponse
+	// OrderID is the orderID of the CheckAccount call of the account.
+	OrderID string
+	// Err is the error of the CheckAccount call, when it failed as a whole.
+	Err error
+}
+
+type bulkOptions struct {
+	chunkSize   int
+	concurrency int
+}
+
+// A BulkOption sets options such as chunk size, concurrency, etc.
+type BulkOption func(*bulkOptions)
+
+// WithChunkSize is a BulkOption to set the number of accounts of each
+// CheckAccount call. Default is MaxCheckAccountsPerRequest, larger sizes are
+// clamped to it.
+func WithChunkSize(n int) BulkOption {
+	return func(o *bulkOptions) {
+		o.chunkSize = n
+	}
+}
+
+// WithConcurrency is a BulkOption to set the maximum number of concurrent
+// CheckAccount calls. Default is 4.
+func WithConcurrency(n int) BulkOption {
+	return func(o *bulkOptions) {
+		o.concurrency = n
+	}
+}
+
+// CheckAccounts checks many accounts, split in chunks checked by
+// concurrent CheckAccount calls, each with its own orderID. The results are
+// in the order of checks. The returned error joins the errors of the failed
+// calls, whose accounts have their Err set.
+func CheckAccounts(ctx context.Context, api PartnerAPI, checks []CheckAccount, opt ...BulkOption) ([]CheckAccountResult, error) {
+	opts := bulkOptions{
+		chunkSize:   MaxCheckAccountsPerRequest,
+		concurrency: 4,
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+	if opts.chunkSize < 1 {
+		opts.chunkSize = 1
+	} else if opts.chunkSize > MaxCheckAccountsPerRequest {
+		opts.chunkSize = MaxCheckAccountsPerRequest
+	}
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+
+	results := make([]CheckAccountResult, len(checks))
+	errs := make([]error, (len(checks)+opts.chunkSize-1)/opts.chunkSize)
+	sem := make(chan struct{}, opts.concurrency)
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(checks); start += opts.chunkSize {
+		end := start + opts.chunkSize
+		if end > len(checks) {
+			end = len(checks)
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			for i := start; i < len(checks); i++ {
+				results[i] = CheckAccountResult{CheckAccountResponse: CheckAccountResponse{CheckAccount: checks[i]}, Err: ctx.Err()}
+			}
+			errs[start/opts.chunkSize] = ctx.Err()
+			wg.Wait()
+			return results, errors.Join(errs...)
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			orderID := GenOrderID()
+			res, err := api.CheckAccount(ctx, orderID, checks[start:end]...)
+			errs[start/opts.chunkSize] = err
+			fillCheckAccountResults(results[start:end], checks[start:end], res, orderID, err)
+		}(start, end)
+	}
+	wg.Wait()
+
+	return results, errors.Join(errs...)
+}
+
+// fillCheckAccountResults matches the responses of a chunk to its checks,
+// by position when Viettel answered every check, else by MSISDN.
+func fillCheckAccountResults(results []CheckAccountResult, checks []CheckAccount, res []CheckAccountResponse, orderID string, err error) {
+	byMSISDN := map[string]CheckAccountResponse{}
+	if len(res) != len(checks) {
+		for _, r := range res {
+			byMSISDN[r.MSISDN] = r
+		}
+	}
+
+	for i, c := range checks {
+		r := CheckAccountResponse{CheckAccount: c}
+		if len(res) == len(checks) {
+			r = res[i]
+		} else if found, ok := byMSISDN[c.MSISDN]; ok {
+			r = found
+		}
+
+		results[i] = CheckAccountResult{CheckAccountResponse: r, OrderID: orderID}
+		if r.ErrorCode == "" {
+			results[i].Err = err
+		}
+	}
+}
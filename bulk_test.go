@@ -0,0 +1,105 @@
+package viettelpay_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAccounts(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var calls, inFlight, maxInFlight int
+	api, err := srv.PartnerAPI(viettelpay.WithInterceptors(func(ctx context.Context, req viettelpay.Request, result interface{}, invoker viettelpay.Invoker) (*viettelpay.EnvelopeResponseData, error) {
+		mu.Lock()
+		calls++
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+
+		return invoker(ctx, req, result)
+	}))
+	require.NoError(t, err)
+
+	checks := make([]viettelpay.CheckAccount, 25)
+	for i := range checks {
+		checks[i] = viettelpay.CheckAccount{MSISDN: fmt.Sprintf("843652338%02d", i), CustomerName: fmt.Sprintf("Customer %d", i)}
+	}
+
+	results, err := viettelpay.CheckAccounts(context.Background(), api, checks,
+		viettelpay.WithChunkSize(10),
+		viettelpay.WithConcurrency(2),
+	)
+	require.NoError(t, err)
+	require.Len(t, results, len(checks))
+	assert.Equal(t, 3, calls)
+	assert.LessOrEqual(t, maxInFlight, 2)
+
+	orderIDs := map[string]bool{}
+	for i, r := range results {
+		assert.Equal(t, checks[i].MSISDN, r.MSISDN)
+		assert.Equal(t, viettelpay.CodeSuccess, r.ErrorCode)
+		assert.NoError(t, r.Err)
+		orderIDs[r.OrderID] = true
+	}
+	assert.Len(t, orderIDs, 3)
+}
+
+func TestCheckAccountsChunkLimit(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var sizes []int
+	api, err := srv.PartnerAPI(viettelpay.WithInterceptors(func(ctx context.Context, req viettelpay.Request, result interface{}, invoker viettelpay.Invoker) (*viettelpay.EnvelopeResponseData, error) {
+		res, err := invoker(ctx, req, result)
+		mu.Lock()
+		sizes = append(sizes, len(*result.(*[]viettelpay.CheckAccountResponse)))
+		mu.Unlock()
+		return res, err
+	}))
+	require.NoError(t, err)
+
+	checks := make([]viettelpay.CheckAccount, viettelpay.MaxCheckAccountsPerRequest+1)
+	for i := range checks {
+		checks[i] = viettelpay.CheckAccount{MSISDN: fmt.Sprintf("84365%06d", i), CustomerName: fmt.Sprintf("Customer %d", i)}
+	}
+
+	_, err = viettelpay.CheckAccounts(context.Background(), api, checks, viettelpay.WithChunkSize(1000))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int{viettelpay.MaxCheckAccountsPerRequest, 1}, sizes)
+}
+
+func TestCheckAccountsError(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	api, err := srv.PartnerAPI(viettelpay.WithAuth("partner", "wrong", "PARTNER"))
+	require.NoError(t, err)
+
+	results, err := viettelpay.CheckAccounts(context.Background(), api, []viettelpay.CheckAccount{
+		{MSISDN: "84365233899", CustomerName: "Nguyen Van A"},
+	})
+	assert.ErrorIs(t, err, &viettelpay.Error{Code: emulator.CodeAuthFailed})
+	require.Len(t, results, 1)
+	assert.ErrorIs(t, results[0].Err, &viettelpay.Error{Code: emulator.CodeAuthFailed})
+	assert.Equal(t, "84365233899", results[0].MSISDN)
+}
@@ -0,0 +1,62 @@
+package cassette_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/cassette"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	ctx := context.Background()
+	check := viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Nguyen Van A"}
+
+	srv, err := emulator.NewServer(emulator.WithPendingQueries(1))
+	require.NoError(t, err)
+
+	rec, err := cassette.New(path, cassette.ModeRecord, srv.HTTP.Client())
+	require.NoError(t, err)
+	api, err := srv.PartnerAPI(viettelpay.WithHTTPClient(rec))
+	require.NoError(t, err)
+
+	recorded, err := api.CheckAccount(ctx, "ORDER1", check)
+	require.NoError(t, err)
+	_, err = api.RequestDisbursement(ctx, "ORDER2", "Test", viettelpay.RequestDisbursement{
+		TransactionID: "TRANS1", MSISDN: check.MSISDN, CustomerName: check.CustomerName, Amount: 1000,
+	})
+	require.NoError(t, err)
+	_, _, err = api.QueryRequests(ctx, "ORDER2", nil)
+	require.True(t, errors.Is(err, viettelpay.ErrBatchWaitDisb))
+	_, _, err = api.QueryRequests(ctx, "ORDER2", nil)
+	require.True(t, errors.Is(err, viettelpay.ErrBatchDisbSuccess))
+	require.NoError(t, rec.Save())
+
+	// Replay without the emulator, only its Viettel public key is needed to
+	// verify the recorded responses.
+	srv.Close()
+
+	rec, err = cassette.New(path, cassette.ModeReplay, nil)
+	require.NoError(t, err)
+	api, err = srv.PartnerAPI(viettelpay.WithHTTPClient(rec))
+	require.NoError(t, err)
+
+	replayed, err := api.CheckAccount(ctx, "ORDER1", check)
+	require.NoError(t, err)
+	assert.Equal(t, recorded, replayed)
+
+	_, status, err := api.QueryRequests(ctx, "ORDER2", nil)
+	assert.True(t, errors.Is(err, viettelpay.ErrBatchWaitDisb))
+	assert.Equal(t, viettelpay.BatchPending, status)
+	_, status, _ = api.QueryRequests(ctx, "ORDER2", nil)
+	assert.Equal(t, viettelpay.BatchSucceeded, status)
+
+	_, _, err = api.QueryRequests(ctx, "ORDER2", nil)
+	assert.True(t, errors.Is(err, cassette.ErrNoInteraction))
+}
@@ -5,6 +5,9 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 type EnvelopeBase struct {
@@ -28,6 +31,9 @@ func (e *EnvelopeBase) SetPassword(val string) {
 func (e *EnvelopeBase) SetServiceCode(val string) {
 	e.ServiceCode = val
 }
+func (e *EnvelopeBase) envelopeBase() *EnvelopeBase {
+	return e
+}
 
 type EnvelopeResponse struct {
 	Data      json.RawMessage `json:"data"`
@@ -50,6 +56,10 @@ type EnvelopeResponseData struct {
 
 	ErrorCode string `json:"errorCode"`
 	ErrorDesc string `json:"errorDesc"`
+
+	// KeyID is the ID of the Viettel public key which verified the
+	// response, when the KeyStore is a KeyIDVerifier.
+	KeyID string `json:"-"`
 }
 
 func (e EnvelopeResponseData) CheckError() error {
@@ -69,9 +79,32 @@ func (e EnvelopeResponseData) CheckError() error {
 }
 
 func (s *partnerAPI) Process(ctx context.Context, req Request, result interface{}) error {
+	_, err := s.process(ctx, req, result)
+	return err
+}
+
+func (s *partnerAPI) process(ctx context.Context, req Request, result interface{}) (res *EnvelopeResponseData, err error) {
+	ctx, span := s.tracer.Start(ctx, "viettelpay "+req.Command(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(requestAttributes(req)...),
+	)
+	defer func() {
+		span.SetAttributes(responseAttributes(res)...)
+
+		// Batch errors carry the batch status, not a failure of the call.
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			span.End()
+		} else {
+			endSpan(span, err)
+		}
+	}()
+
+	_, encSpan := s.tracer.Start(ctx, "viettelpay.encrypt")
 	passwordEncrypted, err := s.keyStore.Encrypt(([]byte)(s.password))
+	endSpan(encSpan, err)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	envReq := req.Envelope()
@@ -79,56 +112,89 @@ func (s *partnerAPI) Process(ctx context.Context, req Request, result interface{
 	envReq.SetServiceCode(s.serviceCode)
 	envReq.SetUsername(s.username)
 
+	return s.invoker(ctx, req, result)
+}
+
+// invoke marshals the data of req into its envelope and signs it, calls the
+// partner API, then verifies and decodes its response. The data is marshalled
+// here, after the interceptors, so that they may modify it.
+func (s *partnerAPI) invoke(ctx context.Context, req Request, result interface{}) (*EnvelopeResponseData, error) {
+	envReq := req.Envelope()
 	if data := req.Data(); data != nil {
 		buf := bytes.NewBuffer(nil)
-		if err = MarshalGzipJSON(buf, data); err != nil {
-			return err
+		if err := MarshalGzipJSON(buf, data); err != nil {
+			return nil, err
 		}
 		envReq.SetData(buf.Bytes())
 	}
 
 	envReqJSON, err := json.Marshal(envReq)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	_, signSpan := s.tracer.Start(ctx, "viettelpay.sign")
 	signature, err := s.keyStore.Sign(envReqJSON)
+	endSpan(signSpan, err)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	res, err := s.call(ctx, &Process{
+	proc := &Process{
 		Cmd:       req.Command(),
 		Data:      string(envReqJSON),
 		Signature: base64.StdEncoding.EncodeToString(signature),
+	}
+
+	var res *ProcessResponse
+	callCtx, callSpan := s.tracer.Start(ctx, "viettelpay.soap", trace.WithSpanKind(trace.SpanKindClient))
+	err = s.callWithRetry(callCtx, proc.Cmd, func() (err error) {
+		res, err = s.call(callCtx, proc)
+		return err
 	})
+	endSpan(callSpan, err)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var envRes EnvelopeResponse
 	err = json.NewDecoder(bytes.NewBufferString(res.Return_)).
 		Decode(&envRes)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err = s.keyStore.Verify(envRes.Data, envRes.Signature); err != nil {
-		return err
+	var keyID string
+	_, verifySpan := s.tracer.Start(ctx, "viettelpay.verify")
+	if v, ok := s.keyStore.(KeyIDVerifier); ok {
+		keyID, err = v.VerifyKeyID(envRes.Data, envRes.Signature)
+		verifySpan.SetAttributes(AttrKeyID.String(keyID))
+	} else {
+		err = s.keyStore.Verify(envRes.Data, envRes.Signature)
+	}
+	endSpan(verifySpan, err)
+	if err != nil {
+		return nil, err
 	}
 
 	var envResData EnvelopeResponseData
 	if err = json.Unmarshal(envRes.Data, &envResData); err != nil {
-		return err
+		return nil, err
 	}
+	envResData.KeyID = keyID
 
 	if data := envResData.Data; data != nil {
 		// NOTE: VTP also return data in case errors happen.
 		// So, we unmarshal data first then check error late.
 		err = UnmarshalGzipJSON(bytes.NewReader(envResData.Data), result)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return envResData.CheckError()
+	err = envResData.CheckError()
+	if s.batchSuccessAsNil && errors.Is(err, ErrBatchDisbSuccess) {
+		err = nil
+	}
+
+	return &envResData, err
 }
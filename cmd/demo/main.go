@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"os"
 
 	"giautm.dev/viettelpay"
 
 	_ "gocloud.dev/runtimevar/constantvar"
 	_ "gocloud.dev/runtimevar/filevar"
+	_ "gocloud.dev/secrets/localsecrets"
 )
 
 var reqs = []viettelpay.CheckAccount{
@@ -43,15 +46,14 @@ func main() {
 		panic(err)
 	}
 
-	partnerAPI, err := viettelpay.ProvidePartnerAPI(cfg, nil)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	partnerAPI, err := viettelpay.ProvidePartnerAPI(cfg, nil, viettelpay.WithLogger(logger))
 	if err != nil {
 		panic(err)
 	}
 
 	orderID := viettelpay.GenOrderID()
-	fmt.Println("orderID", orderID)
-	result, err := partnerAPI.CheckAccount(ctx, orderID, reqs...)
-	fmt.Println(result)
+	_, err = partnerAPI.CheckAccount(ctx, orderID, reqs...)
 	if err != nil {
 		panic(err)
 	}
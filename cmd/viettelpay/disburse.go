@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	vtp "giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/sqliteledger"
+	"github.com/urfave/cli/v2"
+	"github.com/xuri/excelize/v2"
+)
+
+// payoutColumns maps the accepted header names of a payout or verify file
+// to its columns.
+var payoutColumns = map[string]string{
+	"msisdn":        "msisdn",
+	"phone":         "msisdn",
+	"name":          "name",
+	"customer_name": "name",
+	"amount":        "amount",
+	"sms_content":   "sms_content",
+	"sms":           "sms_content",
+	"note":          "note",
+}
+
+var amountPattern = regexp.MustCompile(`^\d{1,3}([.,]\d{3})+$|^\d+$`)
+
+// maxOrderLines is the default largest number of payouts of an order. It is
+// a bound set by this command, not a limit quoted from the partner
+// specification; change it with --max-lines to the limit agreed with Viettel.
+const maxOrderLines = 100
+
+// payoutLine is a line of a payout file.
+type payoutLine struct {
+	Row int
+	vtp.RequestDisbursement
+}
+
+func disburseCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "disburse",
+		Usage:     "Disburse the payouts of a CSV or XLSX file",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "file",
+				Aliases:  []string{"f"},
+				Usage:    "Path to the payout file with msisdn, name, amount, sms_content and note columns",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "content",
+				Aliases:  []string{"c"},
+				Usage:    "Transaction content of the order",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "result-file",
+				Aliases: []string{"r"},
+				Usage:   "Path to the CSV result file, default is <orderID>.csv",
+			},
+			&cli.StringFlag{
+				Name:    "ledger",
+				Usage:   "Path to the SQLite ledger recording the orders",
+				Value:   "viettelpay-ledger.db",
+				EnvVars: []string{"VIETTELPAY_LEDGER"},
+			},
+			&cli.IntFlag{
+				Name:  "max-lines",
+				Usage: "Largest number of payouts of an order, a larger file is rejected",
+				Value: maxOrderLines,
+			},
+			&cli.DurationFlag{
+				Name:  "reconcile-delay",
+				Usage: "Delay before each query reconciling an order whose submission failed",
+				Value: 2 * time.Second,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			ctx := c.Context
+
+			lines, err := readPayoutFile(c.String("file"))
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Failed to read payout file. Error: %v", err), exitError)
+			}
+			if limit := c.Int("max-lines"); len(lines) > limit {
+				return cli.Exit(fmt.Sprintf("The payout file has %d payouts, more than %d per order. Split it in several files.", len(lines), limit), exitError)
+			}
+
+			format, err := outputFormat(c, "")
+			if err != nil {
+				return err
+			}
+
+			var total uint64
+			reqs := make([]vtp.RequestDisbursement, len(lines))
+			for i, l := range lines {
+				l.TransactionID = vtp.GenOrderID()
+				reqs[i] = l.RequestDisbursement
+				total += l.Amount
+			}
+
+			// Keep the output machine-readable, the summary goes to the
+			// error output unless printed as a table.
+			prompt := c.App.Writer
+			if format != outputTable {
+				prompt = c.App.ErrWriter
+			}
+
+			orderID := vtp.GenOrderID()
+			fmt.Fprintf(prompt, "Order:   %s\nContent: %s\nCount:   %d\nTotal:   %d VND\n",
+				orderID, c.String("content"), len(reqs), total)
+			fmt.Fprint(prompt, "Type the total amount in VND to confirm: ")
+
+			answer, err := bufio.NewReader(c.App.Reader).ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return cli.Exit(fmt.Sprintf("Failed to read confirmation, nothing was disbursed. Error: %v", err), exitError)
+			}
+			if strings.TrimSpace(answer) != strconv.FormatUint(total, 10) {
+				return cli.Exit("Aborted, nothing was disbursed.", exitError)
+			}
+
+			path := c.String("result-file")
+			if path == "" {
+				path = orderID + ".csv"
+			}
+			resultFile, err := createResultFile(path)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Failed to create result file, nothing was disbursed. Error: %v", err), exitError)
+			}
+			defer resultFile.Close()
+
+			ledger, err := sqliteledger.Open(ctx, c.String("ledger"))
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Failed to open ledger. Error: %v", err), exitError)
+			}
+			defer ledger.Close()
+
+			client, err := initialClient(c, vtp.WithLedger(ledger))
+			if err != nil {
+				return err
+			}
+
+			_, reqErr := vtp.SafeRequestDisbursement(ctx, client, orderID, c.String("content"), reqs,
+				vtp.WithReconcileDelay(c.Duration("reconcile-delay")))
+
+			// The ledger holds the outcome of every line, including the
+			// ones of an order which could not be reconciled.
+			order, err := ledger.Order(ctx, orderID)
+			if err != nil {
+				order = &vtp.LedgerOrder{OrderID: orderID}
+			}
+			records := newDisbursementResults(orderID, reqs, order)
+			for _, r := range records {
+				if reqErr == nil && (r.Status == string(vtp.LedgerRejected) || r.Status == string(vtp.LedgerFailed)) {
+					reqErr = lineError(r.ErrorCode, r.ErrorDesc)
+				}
+			}
+
+			if err = writeDisbursementResults(resultFile, records); err != nil {
+				return cli.Exit(fmt.Sprintf("Failed to write results of order %s. Error: %v", orderID, err), exitError)
+			}
+			if err = printRecords(c.App.Writer, format, records); err != nil {
+				return cli.Exit(fmt.Sprintf("Failed to print results. Error: %v", err), exitError)
+			}
+			fmt.Fprintf(prompt, "Results of order %s written to %s\n", orderID, path)
+
+			return exitWith(fmt.Sprintf("Unable to disburse order %s.", orderID), reqErr)
+		},
+	}
+}
+
+// readPayoutFile reads the lines of a CSV or XLSX payout file. The first
+// row is the header.
+func readPayoutFile(path string) ([]payoutLine, error) {
+	rows, err := readRows(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("empty file")
+	}
+
+	cols, err := columnIndex(rows[0], "msisdn", "name", "amount")
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []payoutLine
+	for i, row := range rows[1:] {
+		if isEmptyRow(row) {
+			continue
+		}
+		cell := cols.cell(row)
+
+		line := payoutLine{Row: i + 2}
+
+		if line.MSISDN, err = normalizeMSISDN(cell("msisdn")); err != nil {
+			return nil, fmt.Errorf("row %d: %w", line.Row, err)
+		}
+		if line.CustomerName = cell("name"); line.CustomerName == "" {
+			return nil, fmt.Errorf("row %d: missing name", line.Row)
+		}
+		if line.Amount, err = parseAmount(cell("amount")); err != nil {
+			return nil, fmt.Errorf("row %d: %w", line.Row, err)
+		}
+		line.SMSContent = cell("sms_content")
+		line.Note = cell("note")
+
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil, errors.New("no payout")
+	}
+
+	return lines, nil
+}
+
+// columns maps the columns of a file to their index.
+type columns map[string]int
+
+// columnIndex indexes the columns of a header row, see payoutColumns, and
+// checks the required ones are present.
+func columnIndex(header []string, required ...string) (columns, error) {
+	cols := columns{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if col, ok := payoutColumns[strings.ReplaceAll(h, " ", "_")]; ok {
+			cols[col] = i
+		}
+	}
+	for _, col := range required {
+		if _, ok := cols[col]; !ok {
+			return nil, fmt.Errorf("missing %s column", col)
+		}
+	}
+
+	return cols, nil
+}
+
+// cell returns a func to get the trimmed cells of row.
+func (cols columns) cell(row []string) func(col string) string {
+	return func(col string) string {
+		if j, ok := cols[col]; ok && j < len(row) {
+			return strings.TrimSpace(row[j])
+		}
+		return ""
+	}
+}
+
+func isEmptyRow(row []string) bool {
+	return strings.TrimSpace(strings.Join(row, "")) == ""
+}
+
+func readRows(path string) ([][]string, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".csv":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		return r.ReadAll()
+	case ".xlsx":
+		// Raw values keep the digits of number cells, which their format
+		// may show in exponent form.
+		f, err := excelize.OpenFile(path, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return f.GetRows(f.GetSheetName(0))
+	default:
+		return nil, fmt.Errorf("unsupported file extension %q", ext)
+	}
+}
+
+// normalizeMSISDN converts a Vietnamese phone number to the 84 prefixed
+// form expected by ViettelPay. A number cell of a spreadsheet loses the
+// leading 0, so a 9 digit number is taken as missing it.
+func normalizeMSISDN(s string) (string, error) {
+	if strings.ContainsAny(s, "eE") {
+		// A number cell, such as 8.4365233899E+10.
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f == math.Trunc(f) && f < 1e15 {
+			s = strconv.FormatFloat(f, 'f', 0, 64)
+		}
+	}
+	s = strings.NewReplacer(" ", "", ".", "", "-", "").Replace(s)
+	s = strings.TrimPrefix(s, "+")
+	if strings.HasPrefix(s, "0") {
+		s = "84" + s[1:]
+	} else if len(s) == 9 {
+		s = "84" + s
+	}
+
+	if len(s) < 10 || strings.Trim(s, "0123456789") != "" {
+		return "", fmt.Errorf("invalid msisdn %q", s)
+	}
+	return s, nil
+}
+
+// parseAmount parses a VND amount, with optional thousands separators.
+func parseAmount(s string) (uint64, error) {
+	if !amountPattern.MatchString(s) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	amount, err := strconv.ParseUint(strings.NewReplacer(".", "", ",", "").Replace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	if amount == 0 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return amount, nil
+}
+
+// disbursementResult is the result of a line of a disbursement.
+type disbursementResult struct {
+	OrderID      string `json:"orderId"`
+	TransID      string `json:"transId"`
+	MSISDN       string `json:"msisdn"`
+	CustomerName string `json:"customerName"`
+	Amount       uint64 `json:"amount"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorDesc    string `json:"errorDesc"`
+	// Status is the LedgerState of the line, UNKNOWN when it may or may
+	// not have been accepted.
+	Status string `json:"status"`
+}
+
+// newDisbursementResults matches the lines of a disbursement recorded in
+// the ledger to its requests.
+func newDisbursementResults(orderID string, reqs []vtp.RequestDisbursement, order *vtp.LedgerOrder) []disbursementResult {
+	byTransID := make(map[string]vtp.LedgerEntry, len(order.Entries))
+	for _, e := range order.Entries {
+		byTransID[e.TransactionID] = e
+	}
+
+	records := make([]disbursementResult, len(reqs))
+	for i, req := range reqs {
+		r := byTransID[req.TransactionID]
+		status := r.State
+		switch status {
+		case "", vtp.LedgerIntent, vtp.LedgerSubmitted:
+			// The outcome of the line was not recorded.
+			status = vtp.LedgerUnknown
+		}
+		records[i] = disbursementResult{
+			OrderID:      orderID,
+			TransID:      req.TransactionID,
+			MSISDN:       req.MSISDN,
+			CustomerName: req.CustomerName,
+			Amount:       req.Amount,
+			ErrorCode:    r.ErrorCode,
+			ErrorDesc:    r.ErrorDesc,
+			Status:       string(status),
+		}
+	}
+	return records
+}
+
+// createResultFile creates the result file of a disbursement. It must not
+// exist, so that the results of another order are never overwritten.
+func createResultFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+}
+
+// writeDisbursementResults writes the results of a disbursement as CSV.
+func writeDisbursementResults(f *os.File, records []disbursementResult) error {
+	if err := printRecords(f, outputCSV, records); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
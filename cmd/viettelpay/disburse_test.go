@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+	"github.com/xuri/excelize/v2"
+)
+
+// setEmulatorEnv configures the client of the CLI for srv.
+func setEmulatorEnv(t *testing.T, srv *emulator.Server) {
+	constant := func(val string) string {
+		return "constant://?decoder=string&val=" + url.QueryEscape(val)
+	}
+	t.Setenv("VIETTELPAY_BASE_URL", constant(srv.URL))
+	t.Setenv("VIETTELPAY_USERNAME", constant("partner"))
+	t.Setenv("VIETTELPAY_PASSWORD", constant("partner"))
+	t.Setenv("VIETTELPAY_SERVICE_CODE", constant("PARTNER"))
+	t.Setenv("VIETTELPAY_PARTNER_PRIVATE_KEY", constant(string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: srv.Keys.PartnerPrivateKey}))))
+	t.Setenv("VIETTELPAY_VIETTEL_PUBLIC_KEY", constant(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: srv.Keys.ViettelPublicKey}))))
+	t.Setenv("VIETTELPAY_LEDGER", filepath.Join(t.TempDir(), "ledger.db"))
+}
+
+// runCLI runs the CLI with stdin and returns its output and error.
+func runCLI(t *testing.T, stdin string, args ...string) (string, error) {
+	out := bytes.NewBuffer(nil)
+	app := buildCLI()
+	app.Reader = strings.NewReader(stdin)
+	app.Writer = out
+	app.ErrWriter = out
+	app.ExitErrHandler = func(*cli.Context, error) {}
+
+	err := app.RunContext(context.Background(), append([]string{"viettelpay"}, args...))
+	return out.String(), err
+}
+
+func TestReadPayoutFile(t *testing.T) {
+	dir := t.TempDir()
+
+	csvFile := filepath.Join(dir, "payouts.csv")
+	require.NoError(t, os.WriteFile(csvFile, []byte(
+		"MSISDN,Name,Amount,SMS Content,Note\n"+
+			"0365233899,Nguyen Van A,\"1,000\",Thanks,June\n"+
+			",,,,\n"+
+			"+84362634580,Tran Thi B,2500,,\n"), 0o600))
+
+	xlsxFile := filepath.Join(dir, "payouts.xlsx")
+	f := excelize.NewFile()
+	require.NoError(t, f.SetSheetRow("Sheet1", "A1", &[]interface{}{"phone", "customer_name", "amount", "sms", "note"}))
+	require.NoError(t, f.SetSheetRow("Sheet1", "A2", &[]interface{}{"0365233899", "Nguyen Van A", 1000, "Thanks", "June"}))
+	require.NoError(t, f.SetSheetRow("Sheet1", "A3", &[]interface{}{"84362634580", "Tran Thi B", 2500}))
+	require.NoError(t, f.SaveAs(xlsxFile))
+
+	for _, path := range []string{csvFile, xlsxFile} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			lines, err := readPayoutFile(path)
+			require.NoError(t, err)
+			require.Len(t, lines, 2)
+
+			assert.Equal(t, "84365233899", lines[0].MSISDN)
+			assert.Equal(t, "Nguyen Van A", lines[0].CustomerName)
+			assert.Equal(t, uint64(1000), lines[0].Amount)
+			assert.Equal(t, "Thanks", lines[0].SMSContent)
+			assert.Equal(t, "June", lines[0].Note)
+			assert.Equal(t, "84362634580", lines[1].MSISDN)
+			assert.Equal(t, uint64(2500), lines[1].Amount)
+		})
+	}
+
+	// Number cells lose the leading 0 and a format may show them in
+	// exponent form.
+	numeric := filepath.Join(dir, "numeric.xlsx")
+	f = excelize.NewFile()
+	style, err := f.NewStyle(&excelize.Style{NumFmt: 11})
+	require.NoError(t, err)
+	require.NoError(t, f.SetSheetRow("Sheet1", "A1", &[]interface{}{"msisdn", "name", "amount"}))
+	require.NoError(t, f.SetSheetRow("Sheet1", "A2", &[]interface{}{365233899, "Nguyen Van A", 1000}))
+	require.NoError(t, f.SetSheetRow("Sheet1", "A3", &[]interface{}{84362634580, "Tran Thi B", 2500}))
+	require.NoError(t, f.SetCellStyle("Sheet1", "A2", "A3", style))
+	require.NoError(t, f.SaveAs(numeric))
+
+	lines, err := readPayoutFile(numeric)
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "84365233899", lines[0].MSISDN)
+	assert.Equal(t, "84362634580", lines[1].MSISDN)
+
+	bad := filepath.Join(dir, "bad.csv")
+	require.NoError(t, os.WriteFile(bad, []byte("msisdn,name,amount\n0365233899,A,10.5\n"), 0o600))
+	_, err = readPayoutFile(bad)
+	assert.EqualError(t, err, `row 2: invalid amount "10.5"`)
+}
+
+func TestDisburse(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+	setEmulatorEnv(t, srv)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "payouts.csv")
+	require.NoError(t, os.WriteFile(file, []byte("msisdn,name,amount\n0365233899,Nguyen Van A,1000\n0362634580,Tran Thi B,2500\n"), 0o600))
+	output := filepath.Join(dir, "results.csv")
+
+	out, err := runCLI(t, "3499\n", "disburse", "-f", file, "-c", "June payouts", "-r", output)
+	assertExitCode(t, exitError, err)
+	assert.Contains(t, out, "Total:   3500 VND")
+	assert.NotContains(t, out, "(3500)")
+	assert.NoFileExists(t, output)
+
+	_, err = runCLI(t, "3500\n", "disburse", "-f", file, "-c", "June payouts", "-r", output, "--max-lines", "1")
+	assertExitCode(t, exitError, err)
+	assert.NoFileExists(t, output)
+
+	out, err = runCLI(t, "3500\n", "disburse", "-f", file, "-c", "June payouts", "-r", output)
+	require.NoError(t, err, out)
+
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	orderID := records[1][0]
+	assert.Len(t, srv.Disbursements(orderID), 2)
+	for _, r := range records[1:] {
+		assert.Equal(t, orderID, r[0])
+		assert.NotEmpty(t, r[1])
+		assert.Equal(t, "00", r[5])
+		assert.Equal(t, "ACCEPTED", r[7])
+	}
+
+	app := buildCLI()
+	app.Reader = iotest.ErrReader(errors.New("read error"))
+	app.Writer, app.ErrWriter = io.Discard, io.Discard
+	app.ExitErrHandler = func(*cli.Context, error) {}
+	err = app.RunContext(context.Background(), []string{"viettelpay", "disburse", "-f", file, "-c", "June payouts", "-r", output})
+	assertExitCode(t, exitError, err)
+
+	// The results of an order are never overwritten.
+	_, err = runCLI(t, "3500\n", "disburse", "-f", file, "-c", "June payouts", "-r", output)
+	assertExitCode(t, exitError, err)
+	assert.ErrorContains(t, err, "nothing was disbursed")
+	unchanged, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, data, unchanged)
+
+	// Viettel can not be reached, the lines may or may not be accepted.
+	srv.Close()
+	output = filepath.Join(dir, "unknown.csv")
+	out, err = runCLI(t, "3500\n", "disburse", "-f", file, "-c", "June payouts", "-r", output, "--reconcile-delay", "1ms")
+	assertExitCode(t, exitTransport, err)
+
+	data, err = os.ReadFile(output)
+	require.NoError(t, err, out)
+	records, err = csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	for _, r := range records[1:] {
+		assert.Equal(t, "UNKNOWN", r[7])
+	}
+}
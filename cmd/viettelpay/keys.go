@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	vtp "giautm.dev/viettelpay"
+	"github.com/urfave/cli/v2"
+)
+
+// minKeyBits is the smallest key size generated by the keys command.
+const minKeyBits = 2048
+
+// keyPEMFormats maps the PEM block types of keys to their format.
+var keyPEMFormats = map[string]string{
+	vtp.RSAPrivateKeyPEMType:       string(vtp.KeyFormatPKCS1),
+	vtp.PrivateKeyPEMType:          string(vtp.KeyFormatPKCS8),
+	vtp.EncryptedPrivateKeyPEMType: string(vtp.KeyFormatPKCS8) + " (encrypted)",
+	"PUBLIC KEY":                   string(vtp.KeyFormatPKIX),
+	"RSA PUBLIC KEY":               string(vtp.KeyFormatPKCS1),
+	"CERTIFICATE":                  string(vtp.KeyFormatCertificate),
+}
+
+// keyInfo describes a key file.
+type keyInfo struct {
+	File        string `json:"file"`
+	Type        string `json:"type"`
+	Format      string `json:"format"`
+	Bits        int    `json:"bits"`
+	Fingerprint string `json:"fingerprint"`
+	KeyID       string `json:"keyId"`
+
+	public  *rsa.PublicKey
+	private *rsa.PrivateKey
+}
+
+type keyFingerprint struct {
+	File        string `json:"file"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+func passphraseFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "passphrase-file",
+		Usage:   "Path to the passphrase of the private key, - to read it from stdin",
+		EnvVars: []string{"VIETTELPAY_KEY_PASSPHRASE_FILE"},
+	}
+}
+
+func keysCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "keys",
+		Usage: "Generate and check the partner keys",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "generate",
+				Usage:     "Generate a partner key pair",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "bits",
+						Usage: fmt.Sprintf("Size of the key, at least %d", minKeyBits),
+						Value: minKeyBits,
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Format of the private key: pkcs1 or pkcs8",
+						Value: "pkcs8",
+					},
+					passphraseFlag(),
+					&cli.StringFlag{
+						Name:  "private-key",
+						Usage: "Path to the private key",
+						Value: "private.pem",
+					},
+					&cli.StringFlag{
+						Name:  "public-key",
+						Usage: "Path to the public key, to register with Viettel",
+						Value: "public.pem",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Overwrite existing key files",
+					},
+				},
+				Action: generateKeys,
+			},
+			{
+				Name:      "inspect",
+				Usage:     "Show the type, size and fingerprint of keys",
+				ArgsUsage: "FILE...",
+				Flags:     []cli.Flag{passphraseFlag()},
+				Action: func(c *cli.Context) error {
+					infos, err := readKeyArgs(c)
+					if err != nil {
+						return err
+					}
+
+					return printKeyRecords(c, infos)
+				},
+			},
+			{
+				Name:      "fingerprint",
+				Usage:     "Show the SHA-256 fingerprint of keys",
+				ArgsUsage: "FILE...",
+				Flags:     []cli.Flag{passphraseFlag()},
+				Action: func(c *cli.Context) error {
+					infos, err := readKeyArgs(c)
+					if err != nil {
+						return err
+					}
+
+					records := make([]keyFingerprint, len(infos))
+					for i, info := range infos {
+						records[i] = keyFingerprint{File: info.File, Fingerprint: info.Fingerprint}
+					}
+					return printKeyRecords(c, records)
+				},
+			},
+			{
+				Name:      "verify-pair",
+				Usage:     "Check a private key matches the public key registered with Viettel",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "private-key",
+						Usage:    "Path to the private key",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "public-key",
+						Usage:    "Path to the registered public key",
+						Required: true,
+					},
+					passphraseFlag(),
+				},
+				Action: verifyKeyPair,
+			},
+		},
+	}
+}
+
+func generateKeys(c *cli.Context) error {
+	bits := c.Int("bits")
+	if bits < minKeyBits {
+		return cli.Exit(fmt.Sprintf("Keys of %d bits are too small, use at least %d", bits, minKeyBits), exitError)
+	}
+
+	var format vtp.KeyFormat
+	switch strings.ToLower(c.String("format")) {
+	case "pkcs1":
+		format = vtp.KeyFormatPKCS1
+	case "pkcs8":
+		format = vtp.KeyFormatPKCS8
+	default:
+		return cli.Exit(fmt.Sprintf("Unknown key format %q", c.String("format")), exitError)
+	}
+
+	passphrase, err := readPassphrase(c)
+	if err != nil {
+		return err
+	}
+
+	prvPath, pubPath := c.String("private-key"), c.String("public-key")
+	if !c.Bool("force") {
+		for _, path := range []string{prvPath, pubPath} {
+			if _, err := os.Stat(path); err == nil {
+				return cli.Exit(fmt.Sprintf("%s already exists, use --force to overwrite it", path), exitError)
+			}
+		}
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to generate key. Error: %v", err), exitError)
+	}
+	prvPEM, err := marshalPrivateKeyPEM(key, format, passphrase)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to encode private key. Error: %v", err), exitError)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to encode public key. Error: %v", err), exitError)
+	}
+
+	// The keys are written to temporary files first, so that a failure
+	// does not leave a private key without its public key.
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	prvTmp, err := writeTempFile(prvPath, prvPEM, 0o600)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to write private key. Error: %v", err), exitError)
+	}
+	defer os.Remove(prvTmp)
+	pubTmp, err := writeTempFile(pubPath, pubPEM, 0o644)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to write public key. Error: %v", err), exitError)
+	}
+	defer os.Remove(pubTmp)
+
+	if err = moveFile(prvTmp, prvPath, c.Bool("force")); err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to write private key. Error: %v", err), exitError)
+	}
+	if err = moveFile(pubTmp, pubPath, c.Bool("force")); err != nil {
+		os.Remove(prvPath)
+		return cli.Exit(fmt.Sprintf("Failed to write public key. Error: %v", err), exitError)
+	}
+
+	infos := make([]keyInfo, 2)
+	for i, path := range []string{prvPath, pubPath} {
+		if infos[i], err = readKey(path, passphrase); err != nil {
+			return cli.Exit(fmt.Sprintf("Failed to read %s. Error: %v", path, err), exitError)
+		}
+	}
+	return printKeyRecords(c, infos)
+}
+
+func verifyKeyPair(c *cli.Context) error {
+	passphrase, err := readPassphrase(c)
+	if err != nil {
+		return err
+	}
+
+	prv, err := readKey(c.String("private-key"), passphrase)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to read private key. Error: %v", err), exitError)
+	}
+	if prv.private == nil {
+		return cli.Exit(fmt.Sprintf("%s is not a private key", prv.File), exitError)
+	}
+	pub, err := readKey(c.String("public-key"), nil)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to read public key. Error: %v", err), exitError)
+	}
+
+	if err = printKeyRecords(c, []keyInfo{prv, pub}); err != nil {
+		return err
+	}
+	if !prv.private.PublicKey.Equal(pub.public) {
+		return cli.Exit(fmt.Sprintf("%s does not match %s", prv.File, pub.File), exitError)
+	}
+
+	return nil
+}
+
+func printKeyRecords(c *cli.Context, records interface{}) error {
+	format, err := outputFormat(c, "")
+	if err != nil {
+		return err
+	}
+
+	if err = printRecords(c.App.Writer, format, records); err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to print keys. Error: %v", err), exitError)
+	}
+	return nil
+}
+
+func readKeyArgs(c *cli.Context) ([]keyInfo, error) {
+	if c.NArg() == 0 {
+		return nil, cli.Exit("At least one key file is required", exitError)
+	}
+
+	passphrase, err := readPassphrase(c)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]keyInfo, c.NArg())
+	for i, path := range c.Args().Slice() {
+		if infos[i], err = readKey(path, passphrase); err != nil {
+			return nil, cli.Exit(fmt.Sprintf("Failed to read %s. Error: %v", path, err), exitError)
+		}
+	}
+
+	return infos, nil
+}
+
+// readKey reads a private or public key file, PEM or DER encoded.
+func readKey(path string, passphrase []byte) (keyInfo, error) {
+	info := keyInfo{File: path, Format: "DER"}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block != nil {
+		if format, ok := keyPEMFormats[block.Type]; ok {
+			info.Format = format
+		}
+	}
+
+	switch {
+	case block == nil:
+		if info.private, err = vtp.ParsePrivateKey(data); err == nil {
+			break
+		}
+		if info.public, err = vtp.ParsePublicKey(data); err != nil {
+			return info, err
+		}
+	case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+		info.private, err = parseEncryptedPrivateKey(data, passphrase)
+		if errors.Is(err, vtp.ErrEncryptedKey) {
+			return info, fmt.Errorf("%w, use --passphrase-file", err)
+		} else if err != nil {
+			return info, err
+		}
+	default:
+		if info.public, err = vtp.ParsePublicKey(data); err != nil {
+			return info, err
+		}
+	}
+
+	info.Type = "RSA public key"
+	if info.private != nil {
+		info.Type = "RSA private key"
+		info.public = &info.private.PublicKey
+	}
+
+	info.Bits = info.public.N.BitLen()
+	info.Fingerprint = vtp.Fingerprint(info.public)
+	info.KeyID = vtp.KeyID(info.public)
+
+	return info, nil
+}
+
+// readPassphrase reads the passphrase of --passphrase-file, or nil when it
+// is not set.
+func readPassphrase(c *cli.Context) ([]byte, error) {
+	path := c.String("passphrase-file")
+
+	var data []byte
+	var err error
+	switch path {
+	case "":
+		return nil, nil
+	case "-":
+		var line string
+		line, err = bufio.NewReader(rootReader(c)).ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		data = []byte(line)
+	default:
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("Failed to read passphrase. Error: %v", err), exitError)
+	}
+
+	data = bytes.TrimRight(data, "\r\n")
+	if len(data) == 0 {
+		return nil, cli.Exit("Empty passphrase", exitError)
+	}
+	return data, nil
+}
+
+// rootReader returns the Reader of the root app, which the apps of the
+// subcommands do not inherit.
+func rootReader(c *cli.Context) io.Reader {
+	r := c.App.Reader
+	for _, ctx := range c.Lineage() {
+		if ctx.App != nil {
+			r = ctx.App.Reader
+		}
+	}
+	return r
+}
+
+// writeTempFile writes data with perm to a new temporary file next to path,
+// and returns its name.
+func writeTempFile(path string, data []byte, perm os.FileMode) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err = f.Chmod(perm); err == nil {
+		if _, err = f.Write(data); err == nil {
+			err = f.Close()
+		}
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// moveFile moves the file tmp to path, failing if path exists unless force
+// is set.
+func moveFile(tmp, path string, force bool) error {
+	if force {
+		return os.Rename(tmp, path)
+	}
+
+	// Unlike os.Rename, os.Link fails when path exists.
+	if err := os.Link(tmp, path); err != nil {
+		return err
+	}
+	return os.Remove(tmp)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	dir := t.TempDir()
+	prv, pub := filepath.Join(dir, "private.pem"), filepath.Join(dir, "public.pem")
+	passphrase := filepath.Join(dir, "passphrase")
+	require.NoError(t, os.WriteFile(passphrase, []byte("secret\n"), 0o600))
+
+	_, err := runCLI(t, "", "keys", "generate", "--bits", "1024", "--private-key", prv, "--public-key", pub)
+	assertExitCode(t, exitError, err)
+	assert.NoFileExists(t, prv)
+
+	out, err := runCLI(t, "", "--output", "json", "keys", "generate",
+		"--passphrase-file", passphrase, "--private-key", prv, "--public-key", pub)
+	require.NoError(t, err, out)
+	var generated []keyInfo
+	require.NoError(t, json.Unmarshal([]byte(out), &generated), out)
+	require.Len(t, generated, 2)
+	assert.Equal(t, "PKCS#8 (encrypted)", generated[0].Format)
+	assert.Equal(t, 2048, generated[0].Bits)
+	assert.Equal(t, generated[0].Fingerprint, generated[1].Fingerprint)
+
+	info, err := os.Stat(prv)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	_, err = runCLI(t, "", "keys", "generate", "--private-key", prv, "--public-key", pub)
+	assertExitCode(t, exitError, err)
+
+	// Overwriting a private key restores its mode.
+	forcedPrv, forcedPub := filepath.Join(dir, "forced.pem"), filepath.Join(dir, "forced.pub.pem")
+	require.NoError(t, os.WriteFile(forcedPrv, nil, 0o644))
+	_, err = runCLI(t, "", "keys", "generate", "--force", "--private-key", forcedPrv, "--public-key", forcedPub)
+	require.NoError(t, err)
+	info, err = os.Stat(forcedPrv)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// A failed public key write does not leave a private key behind.
+	orphan := filepath.Join(dir, "orphan.pem")
+	_, err = runCLI(t, "", "keys", "generate", "--bits", "2048",
+		"--private-key", orphan, "--public-key", filepath.Join(dir, "missing", "public.pem"))
+	assertExitCode(t, exitError, err)
+	assert.NoFileExists(t, orphan)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.False(t, strings.HasPrefix(e.Name(), "."), e.Name())
+	}
+
+	_, err = runCLI(t, "", "keys", "inspect", prv)
+	assertExitCode(t, exitError, err)
+
+	out, err = runCLI(t, "secret\n", "--output", "jsonl", "keys", "inspect", "--passphrase-file", "-", prv)
+	require.NoError(t, err, out)
+	var inspected keyInfo
+	require.NoError(t, json.Unmarshal([]byte(out), &inspected), out)
+	assert.Equal(t, generated[0], inspected)
+
+	out, err = runCLI(t, "", "--output", "csv", "keys", "fingerprint", pub)
+	require.NoError(t, err, out)
+	assert.Equal(t, "file,fingerprint\n"+pub+","+generated[1].Fingerprint+"\n", out)
+
+	_, err = runCLI(t, "", "keys", "verify-pair", "--passphrase-file", passphrase, "--private-key", prv, "--public-key", pub)
+	assert.NoError(t, err)
+
+	otherPrv, otherPub := filepath.Join(dir, "other.pem"), filepath.Join(dir, "other.pub.pem")
+	_, err = runCLI(t, "", "keys", "generate", "--format", "pkcs1", "--private-key", otherPrv, "--public-key", otherPub)
+	require.NoError(t, err)
+
+	_, err = runCLI(t, "", "keys", "verify-pair", "--private-key", otherPrv, "--public-key", pub)
+	assertExitCode(t, exitError, err)
+}
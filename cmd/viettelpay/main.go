@@ -1,21 +1,30 @@
 package main
 
 import (
-	"context"
-	"errors"
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 
 	vtp "giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
 	"github.com/urfave/cli/v2"
 
 	_ "gocloud.dev/runtimevar/constantvar"
 	_ "gocloud.dev/runtimevar/filevar"
+	_ "gocloud.dev/secrets/localsecrets"
 )
 
 func main() {
 	app := buildCLI()
-	_ = app.Run(os.Args)
+	if err := app.Run(os.Args); err != nil {
+		// Exit errors already exited, others would exit 0.
+		fmt.Fprintf(app.ErrWriter, "Error: %v\n", err)
+		os.Exit(exitError)
+	}
 }
 
 func buildCLI() *cli.App {
@@ -23,32 +32,74 @@ func buildCLI() *cli.App {
 	app.Name = "viettelpay"
 	app.Usage = "Viettel Pay Tools"
 	app.ArgsUsage = " "
-	app.Flags = []cli.Flag{}
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "profile",
+			Aliases: []string{"p"},
+			Usage:   "Profile of the config file, such as sandbox or production",
+			EnvVars: []string{"VIETTELPAY_PROFILE"},
+		},
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "Path to the config file (YAML or TOML)",
+		},
+		outputFlag(),
+	}
 
 	app.Commands = []*cli.Command{
 		{
 			Name:  "verify",
-			Usage: "Verify VTP account",
+			Usage: "Verify VTP account, or the accounts of a CSV or XLSX file",
 			Flags: []cli.Flag{
 				&cli.StringFlag{
-					Name:     "msisdn",
-					Aliases:  []string{"m"},
-					Usage:    "MSISDN",
-					Required: true,
+					Name:    "msisdn",
+					Aliases: []string{"m"},
+					Usage:   "MSISDN",
 				},
 				&cli.StringFlag{
-					Name:     "name",
-					Aliases:  []string{"n"},
-					Usage:    "Customer Name",
-					Required: true,
+					Name:    "name",
+					Aliases: []string{"n"},
+					Usage:   "Customer Name",
+				},
+				&cli.StringFlag{
+					Name:    "file",
+					Aliases: []string{"f"},
+					Usage:   "Path to a file with msisdn and name columns",
+				},
+				&cli.StringFlag{
+					Name:    "result-file",
+					Aliases: []string{"r"},
+					Usage:   "Path to the results of --file, in the format of its extension unless --output is set",
+				},
+				&cli.IntFlag{
+					Name:  "chunk-size",
+					Usage: fmt.Sprintf("Number of accounts per request, at most %d", vtp.MaxCheckAccountsPerRequest),
+					Value: vtp.MaxCheckAccountsPerRequest,
+				},
+				&cli.IntFlag{
+					Name:  "concurrency",
+					Usage: "Maximum number of concurrent requests",
+					Value: 4,
 				},
 			},
 			Action: func(c *cli.Context) error {
 				ctx := c.Context
+				if c.IsSet("file") {
+					return verifyFile(c)
+				}
+
 				msisdn := c.String("msisdn")
 				customerName := c.String("name")
+				if msisdn == "" || customerName == "" {
+					return cli.Exit("Either --file, or --msisdn and --name are required", exitError)
+				}
+
+				format, err := outputFormat(c, "")
+				if err != nil {
+					return err
+				}
 
-				client, err := initialClient(ctx)
+				client, err := initialClient(c)
 				if err != nil {
 					return err
 				}
@@ -58,15 +109,18 @@ func buildCLI() *cli.App {
 					MSISDN:       msisdn,
 					CustomerName: customerName,
 				})
-				for _, r := range results {
-					fmt.Printf("%s - %s: %s\n", r.MSISDN, r.ErrorCode, r.ErrorDesc)
+				records := make([]checkResult, len(results))
+				for i, r := range results {
+					records[i] = newCheckResult(vtp.CheckAccountResult{CheckAccountResponse: r, OrderID: orderID})
+					if err == nil {
+						err = lineError(r.ErrorCode, r.ErrorDesc)
+					}
 				}
-				if err != nil {
-					// Panic for other error
-					return cli.Exit(fmt.Sprintf("Unable to query result. Error: %v", err), 1)
+				if perr := printRecords(c.App.Writer, format, records); perr != nil {
+					return cli.Exit(fmt.Sprintf("Failed to print results. Error: %v", perr), exitError)
 				}
 
-				return nil
+				return exitWith("Unable to verify account.", err)
 			},
 		},
 		{
@@ -85,45 +139,202 @@ func buildCLI() *cli.App {
 				ctx := c.Context
 				orderID := c.String("orderID")
 
-				client, err := initialClient(ctx)
+				format, err := outputFormat(c, "")
 				if err != nil {
 					return err
 				}
 
-				results, err := client.QueryRequests(ctx, orderID, nil)
-				for _, r := range results {
-					fmt.Printf("%s - %v\n", r.TransactionID, r.Err())
+				client, err := initialClient(c)
+				if err != nil {
+					return err
 				}
 
-				var batchErr *vtp.BatchError
-				if errors.As(err, &batchErr) {
-					if batchErr.Is(vtp.ErrBatchDisbSuccess) {
-						fmt.Println("Chi thành công")
-					} else {
-						fmt.Println(batchErr.Error())
+				results, status, err := client.QueryRequests(ctx, orderID, nil)
+				records := make([]queryResult, len(results))
+				for i, r := range results {
+					records[i] = queryResult{
+						OrderID:      orderID,
+						TransID:      r.TransactionID,
+						MSISDN:       r.MSISDN,
+						CustomerName: r.CustomerName,
+						Amount:       r.Amount,
+						ErrorCode:    r.ErrorCode,
+						ErrorMsg:     r.ErrorMsg,
+						BatchStatus:  status.String(),
 					}
-				} else if err != nil {
-					// Panic for other error
-					return cli.Exit(fmt.Sprintf("Unable to query result. Error: %v", err), 1)
+				}
+				if perr := printRecords(c.App.Writer, format, records); perr != nil {
+					return cli.Exit(fmt.Sprintf("Failed to print results. Error: %v", perr), exitError)
+				}
+				if format == outputTable && status != vtp.BatchUnknown {
+					fmt.Fprintf(c.App.Writer, "Batch %s: %s\n", orderID, status)
+				}
+
+				return exitWith(fmt.Sprintf("Unable to query order %s.", orderID), err)
+			},
+		},
+		disburseCommand(),
+		keysCommand(),
+		{
+			Name:      "emulator",
+			Usage:     "Run a local ViettelPay partner API emulator",
+			ArgsUsage: " ",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "addr",
+					Usage: "Address to listen on",
+					Value: "127.0.0.1:8080",
+				},
+				&cli.StringFlag{
+					Name:     "partner-public-key",
+					Usage:    "Path to the partner public key (PEM)",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "viettel-private-key",
+					Usage: "Path to the Viettel private key (PEM), generated when omitted",
+				},
+				&cli.StringFlag{
+					Name:  "username",
+					Usage: "Partner username to accept",
+				},
+				&cli.StringFlag{
+					Name:  "password",
+					Usage: "Partner password to accept",
+				},
+				&cli.StringFlag{
+					Name:  "service-code",
+					Usage: "Partner service code to accept",
+				},
+				&cli.StringFlag{
+					Name:  "accounts",
+					Usage: "Path to a JSON file of known accounts",
+				},
+				&cli.IntFlag{
+					Name:  "pending",
+					Usage: "Number of queries a batch stays in progress",
+					Value: 2,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				handler, err := initialEmulator(c)
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("Failed to initial emulator. Error: %v", err), exitError)
 				}
 
-				return nil
+				fmt.Printf("Listening on http://%s/\n", c.String("addr"))
+				return http.ListenAndServe(c.String("addr"), handler)
 			},
 		},
 	}
 	return app
 }
 
-func initialClient(ctx context.Context) (vtp.PartnerAPI, error) {
-	cfg, err := vtp.ProvideConfig(ctx)
+func initialEmulator(c *cli.Context) (*emulator.Emulator, error) {
+	partnerPubKey, err := readPEM(c.String("partner-public-key"))
 	if err != nil {
-		return nil, cli.Exit(fmt.Sprintf("Failed to read config. Error: %v", err), 1)
+		return nil, err
 	}
 
-	partnerAPI, err := vtp.ProvidePartnerAPI(cfg, nil)
+	var viettelPriKey []byte
+	if path := c.String("viettel-private-key"); path != "" {
+		if viettelPriKey, err = readPEM(path); err != nil {
+			return nil, err
+		}
+	} else {
+		prvKey, pubKey := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+		if err = vtp.GenerateKeysPEM(prvKey, pubKey, 2048); err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(prvKey.Bytes())
+		viettelPriKey = block.Bytes
+
+		fmt.Println("Generated Viettel public key, set it as VIETTELPAY_VIETTEL_PUBLIC_KEY:")
+		fmt.Print(pubKey.String())
+	}
+
+	keyStore, err := vtp.NewKeyStore(viettelPriKey, partnerPubKey)
 	if err != nil {
-		return nil, cli.Exit(fmt.Sprintf("Failed to initial partner api. Error: %v", err), 1)
+		return nil, err
+	}
+
+	opts := []emulator.Option{
+		emulator.WithPendingQueries(c.Int("pending")),
+	}
+	if c.IsSet("username") || c.IsSet("password") || c.IsSet("service-code") {
+		opts = append(opts, emulator.WithCredentials(
+			c.String("username"), c.String("password"), c.String("service-code"),
+		))
+	}
+	if path := c.String("accounts"); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var accounts []emulator.Account
+		if err = json.Unmarshal(data, &accounts); err != nil {
+			return nil, err
+		}
+		opts = append(opts, emulator.WithAccounts(accounts...))
+	}
+
+	return emulator.New(keyStore, opts...), nil
+}
+
+func readPEM(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var block vtp.BlockPEM
+	if err = block.EnvDecode(string(data)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return block.Bytes(), nil
+}
+
+// initialConfig reads the config from the environment, or from the
+// profile of the config file when --profile or --config is set.
+func initialConfig(c *cli.Context) (*vtp.Config, error) {
+	profile, path := c.String("profile"), c.String("config")
+	if profile == "" && path == "" {
+		return vtp.ProvideConfig(c.Context)
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	if path == "" {
+		return vtp.ProvideConfigProfile(c.Context, profile)
+	}
+
+	return vtp.ProvideConfigFile(c.Context, path, profile)
+}
+
+func initialClient(c *cli.Context, opt ...vtp.Option) (vtp.PartnerAPI, error) {
+	cfg, err := initialConfig(c)
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("Failed to read config. Error: %v", err), exitError)
+	}
+
+	partnerAPI, err := vtp.ProvidePartnerAPI(cfg, nil, opt...)
+	if err != nil {
+		return nil, cli.Exit(fmt.Sprintf("Failed to initial partner api. Error: %v", err), exitError)
 	}
 
 	return partnerAPI, nil
 }
+
+// queryResult is a line of the query command.
+type queryResult struct {
+	OrderID      string `json:"orderId"`
+	TransID      string `json:"transId"`
+	MSISDN       string `json:"msisdn"`
+	CustomerName string `json:"customerName"`
+	Amount       uint64 `json:"amount"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMsg     string `json:"errorMsg"`
+	BatchStatus  string `json:"batchStatus"`
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	vtp "giautm.dev/viettelpay"
+	"github.com/urfave/cli/v2"
+)
+
+// Output formats of the --output flag.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+	outputCSV   = "csv"
+)
+
+// Exit codes of the commands. They are stable, scripts may rely on them.
+const (
+	// exitOK means the command succeeded, and the batch, if any, was
+	// disbursed.
+	exitOK = 0
+	// exitError means a usage, config or file error.
+	exitError = 1
+	// exitTransport means the partner API could not be reached, or its
+	// response could not be verified.
+	exitTransport = 2
+	// exitBusiness means Viettel rejected the request, or some of its
+	// lines.
+	exitBusiness = 3
+	// exitBatchPending means the batch is not disbursed yet.
+	exitBatchPending = 4
+	// exitBatchFailed means the batch failed, was cancelled or timed out.
+	exitBatchFailed = 5
+)
+
+func outputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Usage:   "Output format: table, json, jsonl or csv",
+		Value:   outputTable,
+		EnvVars: []string{"VIETTELPAY_OUTPUT"},
+	}
+}
+
+// outputFormat returns the --output format, or the format matching the
+// extension of path when --output is not set.
+func outputFormat(c *cli.Context, path string) (string, error) {
+	format := c.String("output")
+	if !c.IsSet("output") && path != "" {
+		switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); ext {
+		case outputJSON, outputJSONL, outputCSV:
+			format = ext
+		}
+	}
+
+	switch format {
+	case outputTable, outputJSON, outputJSONL, outputCSV:
+		return format, nil
+	}
+	return "", cli.Exit(fmt.Sprintf("Unknown output format %q", format), exitError)
+}
+
+// printRecords writes a slice of structs in format. The columns are the
+// json names of the struct fields.
+func printRecords(w io.Writer, format string, records interface{}) error {
+	v := reflect.ValueOf(records)
+
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case outputJSONL:
+		enc := json.NewEncoder(w)
+		for i := 0; i < v.Len(); i++ {
+			if err := enc.Encode(v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var fields []int
+	var header []string
+	t := v.Type().Elem()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, i)
+		header = append(header, name)
+	}
+
+	rows := make([][]string, v.Len())
+	for i := range rows {
+		rows[i] = make([]string, len(fields))
+		for j, f := range fields {
+			rows[i][j] = fmt.Sprint(v.Index(i).Field(f).Interface())
+		}
+	}
+
+	if format == outputCSV {
+		cw := csv.NewWriter(w)
+		_ = cw.Write(header)
+		_ = cw.WriteAll(rows)
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// exitCode returns the exit code matching the error of a partner API call.
+func exitCode(err error) int {
+	var batchErr *vtp.BatchError
+	var vtpErr *vtp.Error
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &batchErr):
+		switch status := batchErr.Status(); {
+		case status == vtp.BatchSucceeded:
+			return exitOK
+		case status.IsFinal():
+			return exitBatchFailed
+		case status != vtp.BatchUnknown:
+			return exitBatchPending
+		}
+		return exitBusiness
+	case errors.As(err, &vtpErr):
+		return exitBusiness
+	}
+	return exitTransport
+}
+
+// lineError returns the error of a line whose code is not "00", else nil.
+func lineError(code, desc string) error {
+	if code == "00" {
+		return nil
+	}
+	return &vtp.Error{Code: code, Desc: desc}
+}
+
+// exitWith returns an error printing msg and err, exiting with the code
+// matching err, or nil when the code is exitOK.
+func exitWith(msg string, err error) error {
+	code := exitCode(err)
+	if code == exitOK {
+		return nil
+	}
+
+	return cli.Exit(fmt.Sprintf("%s Error: %v", msg, err), code)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	vtp "giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// assertExitCode asserts err exits the CLI with code.
+func assertExitCode(t *testing.T, code int, err error) {
+	t.Helper()
+
+	if code == exitOK {
+		assert.NoError(t, err)
+		return
+	}
+
+	var exitErr cli.ExitCoder
+	if assert.True(t, errors.As(err, &exitErr), "error %v is not an exit error", err) {
+		assert.Equal(t, code, exitErr.ExitCode(), err.Error())
+	}
+}
+
+func TestPrintRecords(t *testing.T) {
+	type record struct {
+		ID     string `json:"id"`
+		Amount uint64 `json:"amount"`
+		Hidden string `json:"-"`
+	}
+	records := []record{{ID: "a", Amount: 1000, Hidden: "x"}, {ID: "b", Amount: 2500}}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{outputTable, "ID  AMOUNT\na   1000\nb   2500\n"},
+		{outputCSV, "id,amount\na,1000\nb,2500\n"},
+		{outputJSONL, "{\"id\":\"a\",\"amount\":1000}\n{\"id\":\"b\",\"amount\":2500}\n"},
+		{outputJSON, "[\n  {\n    \"id\": \"a\",\n    \"amount\": 1000\n  },\n  {\n    \"id\": \"b\",\n    \"amount\": 2500\n  }\n]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			require.NoError(t, printRecords(buf, tt.format, records))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitOK, exitCode(nil))
+	assert.Equal(t, exitOK, exitCode(vtp.ErrBatchDisbSuccess))
+	assert.Equal(t, exitTransport, exitCode(errors.New("connection refused")))
+	assert.Equal(t, exitBusiness, exitCode(vtp.ErrAuthFailed))
+	assert.Equal(t, exitBusiness, exitCode(&vtp.BatchError{Code: "UNKNOWN"}))
+	assert.Equal(t, exitBatchPending, exitCode(vtp.ErrBatchWaitDisb))
+	assert.Equal(t, exitBatchPending, exitCode(vtp.ErrBatchDisbursement))
+	assert.Equal(t, exitBatchFailed, exitCode(vtp.ErrBatchDisbFailed))
+	assert.Equal(t, exitBatchFailed, exitCode(vtp.ErrBatchDisbTimeout))
+}
+
+func TestQueryExitCodes(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+	setEmulatorEnv(t, srv)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "payouts.csv")
+	require.NoError(t, os.WriteFile(file, []byte("msisdn,name,amount\n0365233899,Nguyen Van A,1000\n"), 0o600))
+
+	out, err := runCLI(t, "1000\n", "--output", "jsonl", "disburse", "-f", file, "-c", "June payouts", "-r", filepath.Join(dir, "results.csv"))
+	require.NoError(t, err, out)
+	// The prompt and the results share the output of runCLI.
+	var disbursed disbursementResult
+	require.NoError(t, json.NewDecoder(strings.NewReader(out[strings.Index(out, "{"):])).Decode(&disbursed), out)
+	require.NotEmpty(t, disbursed.OrderID)
+
+	for _, code := range []int{exitBatchPending, exitBatchPending, exitOK} {
+		out, err = runCLI(t, "", "--output", "json", "query", "-o", disbursed.OrderID)
+		assertExitCode(t, code, err)
+	}
+	var results []queryResult
+	require.NoError(t, json.Unmarshal([]byte(out), &results), out)
+	require.Len(t, results, 1)
+	assert.Equal(t, disbursed.TransID, results[0].TransID)
+	assert.Equal(t, "Succeeded", results[0].BatchStatus)
+
+	_, err = runCLI(t, "", "query", "-o", "missing")
+	assertExitCode(t, exitBusiness, err)
+
+	srv.Close()
+	_, err = runCLI(t, "", "query", "-o", disbursed.OrderID)
+	assertExitCode(t, exitTransport, err)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+
+	vtp "giautm.dev/viettelpay"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// pbkdf2Iterations is the PBKDF2 iteration count of the keys encrypted by
+// marshalPrivateKeyPEM.
+const pbkdf2Iterations = 600000
+
+// maxPBKDF2Iterations bounds the PBKDF2 iteration count of the keys read by
+// parseEncryptedPrivateKey, so a crafted key file can not hang the command.
+const maxPBKDF2Iterations = 10 * pbkdf2Iterations
+
+// errIncorrectPassphrase is returned by parseEncryptedPrivateKey when the
+// key can not be decrypted with the passphrase.
+var errIncorrectPassphrase = errors.New("incorrect passphrase")
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is the EncryptedPrivateKeyInfo of RFC 5208.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the PBES2-params of RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the PBKDF2-params of RFC 8018.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// marshalPrivateKeyPEM encodes a private key as PEM, in PKCS#1 or PKCS#8
+// form. With a passphrase, the key is a PKCS#8 key encrypted with
+// PBES2, PBKDF2-HMAC-SHA256 and AES-256-CBC, as written by
+// `openssl pkcs8 -topk8 -v2 aes256`.
+func marshalPrivateKeyPEM(key *rsa.PrivateKey, format vtp.KeyFormat, passphrase []byte) ([]byte, error) {
+	switch {
+	case format == vtp.KeyFormatPKCS1 && len(passphrase) == 0:
+		return pem.EncodeToMemory(&pem.Block{
+			Type:  vtp.RSAPrivateKeyPEMType,
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		}), nil
+	case format == vtp.KeyFormatPKCS1:
+		return nil, fmt.Errorf("%s keys can not be encrypted, use %s", vtp.KeyFormatPKCS1, vtp.KeyFormatPKCS8)
+	case format != vtp.KeyFormatPKCS8:
+		return nil, fmt.Errorf("unsupported private key format %q", format)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return pem.EncodeToMemory(&pem.Block{Type: vtp.PrivateKeyPEMType, Bytes: der}), nil
+	}
+
+	if der, err = encryptPKCS8(der, passphrase); err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: vtp.EncryptedPrivateKeyPEMType, Bytes: der}), nil
+}
+
+// parseEncryptedPrivateKey parses a RSA private key encrypted with a
+// passphrase, PEM or DER encoded, such as the keys written by
+// marshalPrivateKeyPEM. Keys which are not encrypted are parsed by
+// ParsePrivateKey.
+func parseEncryptedPrivateKey(data, passphrase []byte) (*rsa.PrivateKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != vtp.EncryptedPrivateKeyPEMType {
+			return vtp.ParsePrivateKey(data)
+		}
+		data = block.Bytes
+	} else if key, err := vtp.ParsePrivateKey(data); err == nil {
+		return key, nil
+	}
+	if len(passphrase) == 0 {
+		return nil, &vtp.KeyFormatError{Kind: "private key", Formats: []vtp.KeyFormat{vtp.KeyFormatPKCS8}, Err: vtp.ErrEncryptedKey}
+	}
+
+	der, err := decryptPKCS8(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return vtp.ParsePrivateKey(der)
+}
+
+func encryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	kdf, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pbkdf2Iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdf}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, salt, pbkdf2Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+}
+
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	unsupported := func(what interface{}) error {
+		return &vtp.KeyFormatError{
+			Kind:    "private key",
+			Formats: []vtp.KeyFormat{vtp.KeyFormatPKCS8},
+			Err:     fmt.Errorf("%w: %v", vtp.ErrUnsupportedKey, what),
+		}
+	}
+
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, &vtp.KeyFormatError{Kind: "private key", Formats: []vtp.KeyFormat{vtp.KeyFormatPKCS8}, Err: err}
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, unsupported(info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	var kdf pbkdf2Params
+	var iv []byte
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, unsupported(err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, unsupported(params.KeyDerivationFunc.Algorithm)
+	}
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, unsupported(err)
+	}
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, unsupported(err)
+	}
+
+	if kdf.IterationCount < 1 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, unsupported(fmt.Sprintf("PBKDF2 iteration count %d", kdf.IterationCount))
+	}
+
+	var prf func() hash.Hash
+	switch alg := kdf.PRF.Algorithm; {
+	case len(alg) == 0, alg.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case alg.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, unsupported(alg)
+	}
+
+	var keyLen int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, unsupported(alg)
+	}
+
+	block, err := aes.NewCipher(pbkdf2.Key(passphrase, kdf.Salt, kdf.IterationCount, keyLen, prf))
+	if err != nil {
+		return nil, err
+	}
+	data := info.EncryptedData
+	if len(iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, unsupported("malformed ciphertext")
+	}
+	data = append([]byte{}, data...)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!bytes.Equal(data[len(data)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errIncorrectPassphrase
+	}
+	data = data[:len(data)-padding]
+	if _, err := x509.ParsePKCS8PrivateKey(data); err != nil {
+		return nil, errIncorrectPassphrase
+	}
+
+	return data, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	vtp "giautm.dev/viettelpay"
+	"github.com/urfave/cli/v2"
+)
+
+// readCheckFile reads the accounts of a CSV or XLSX file with msisdn and
+// name columns.
+func readCheckFile(path string) ([]vtp.CheckAccount, error) {
+	rows, err := readRows(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("empty file")
+	}
+
+	cols, err := columnIndex(rows[0], "msisdn", "name")
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []vtp.CheckAccount
+	for i, row := range rows[1:] {
+		if isEmptyRow(row) {
+			continue
+		}
+		cell := cols.cell(row)
+
+		msisdn, err := normalizeMSISDN(cell("msisdn"))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+2, err)
+		}
+		checks = append(checks, vtp.CheckAccount{MSISDN: msisdn, CustomerName: cell("name")})
+	}
+
+	return checks, nil
+}
+
+// verifyFile checks the accounts of the --file and prints the results, or
+// writes them to the --result-file.
+func verifyFile(c *cli.Context) error {
+	if n := c.Int("chunk-size"); n < 1 || n > vtp.MaxCheckAccountsPerRequest {
+		return cli.Exit(fmt.Sprintf("--chunk-size must be between 1 and %d", vtp.MaxCheckAccountsPerRequest), exitError)
+	}
+
+	checks, err := readCheckFile(c.String("file"))
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to read file. Error: %v", err), exitError)
+	}
+
+	path := c.String("result-file")
+	format, err := outputFormat(c, path)
+	if err != nil {
+		return err
+	}
+
+	client, err := initialClient(c)
+	if err != nil {
+		return err
+	}
+
+	results, checkErr := vtp.CheckAccounts(c.Context, client, checks,
+		vtp.WithChunkSize(c.Int("chunk-size")),
+		vtp.WithConcurrency(c.Int("concurrency")),
+	)
+
+	w := c.App.Writer
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Failed to write results. Error: %v", err), exitError)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	records := make([]checkResult, len(results))
+	for i, r := range results {
+		records[i] = newCheckResult(r)
+		if checkErr == nil {
+			checkErr = lineError(r.ErrorCode, r.ErrorDesc)
+		}
+	}
+	if err = printRecords(w, format, records); err != nil {
+		return cli.Exit(fmt.Sprintf("Failed to write results. Error: %v", err), exitError)
+	}
+
+	return exitWith("Unable to verify some accounts.", checkErr)
+}
+
+type checkResult struct {
+	OrderID      string `json:"orderId"`
+	MSISDN       string `json:"msisdn"`
+	CustomerName string `json:"customerName"`
+	Package      string `json:"package"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorDesc    string `json:"errorDesc"`
+	Error        string `json:"error,omitempty"`
+}
+
+func newCheckResult(r vtp.CheckAccountResult) checkResult {
+	res := checkResult{
+		OrderID:      r.OrderID,
+		MSISDN:       r.MSISDN,
+		CustomerName: r.CustomerName,
+		Package:      r.Package,
+		ErrorCode:    r.ErrorCode,
+		ErrorDesc:    r.ErrorDesc,
+	}
+	if r.Err != nil {
+		res.Error = r.Err.Error()
+	}
+	return res
+}
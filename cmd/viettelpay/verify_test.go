@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyFile(t *testing.T) {
+	srv, err := emulator.NewServer(emulator.WithAccounts(
+		emulator.Account{MSISDN: "84365233899", CustomerName: "Nguyen Van A", Package: "VTP"},
+	))
+	require.NoError(t, err)
+	defer srv.Close()
+	setEmulatorEnv(t, srv)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "accounts.csv")
+	require.NoError(t, os.WriteFile(file, []byte("msisdn,name\n0365233899,Nguyen Van A\n0362634580,Tran Thi B\n0362634581,Le Van C\n"), 0o600))
+
+	_, err = runCLI(t, "", "verify", "-f", file, "--chunk-size", "101")
+	assertExitCode(t, exitError, err)
+
+	out, err := runCLI(t, "", "--output", "csv", "verify", "-f", file, "--chunk-size", "2")
+	assertExitCode(t, exitBusiness, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "orderId,msisdn,customerName,package,errorCode,errorDesc,error", lines[0])
+	assert.Contains(t, lines[1], ",84365233899,Nguyen Van A,VTP,00,")
+
+	output := filepath.Join(dir, "results.json")
+	_, err = runCLI(t, "", "verify", "-f", file, "-r", output)
+	assertExitCode(t, exitBusiness, err)
+
+	data, err := os.ReadFile(output)
+	require.NoError(t, err)
+	var results []map[string]string
+	require.NoError(t, json.Unmarshal(data, &results))
+	require.Len(t, results, 3)
+	assert.Equal(t, "VTP", results[0]["package"])
+	assert.Equal(t, "00", results[0]["errorCode"])
+	assert.NotEqual(t, "00", results[1]["errorCode"])
+}
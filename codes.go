@@ -0,0 +1,198 @@
+package viettelpay
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrorClass groups error codes by how a caller should react to them.
+type ErrorClass int
+
+const (
+	// ClassUnknown is used for codes missing from the catalog.
+	ClassUnknown ErrorClass = iota
+	// ClassNone is used for codes which are not errors, such as "00".
+	ClassNone
+	// ClassRetryable is used for temporary failures, the same request may
+	// succeed later.
+	ClassRetryable
+	// ClassPermanent is used for failures which will not go away by
+	// repeating the same request.
+	ClassPermanent
+	// ClassAuth is used for rejected credentials or signatures.
+	ClassAuth
+	// ClassValidation is used for malformed or inconsistent requests.
+	ClassValidation
+	// ClassAccountNotFound is used when the MSISDN has no ViettelPay account.
+	ClassAccountNotFound
+	// ClassNameMismatch is used when the customer name does not match the
+	// account.
+	ClassNameMismatch
+	// ClassInsufficientBalance is used when the partner balance cannot
+	// cover the disbursement.
+	ClassInsufficientBalance
+	// ClassDuplicateOrder is used when the orderID was already submitted.
+	ClassDuplicateOrder
+	// ClassOrderNotFound is used when Viettel has no order of the orderID.
+	ClassOrderNotFound
+	// ClassPending is used for a batch which is still in progress. It must
+	// not be submitted again, only queried until it is final.
+	ClassPending
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassNone:
+		return "None"
+	case ClassRetryable:
+		return "Retryable"
+	case ClassPermanent:
+		return "Permanent"
+	case ClassAuth:
+		return "Auth"
+	case ClassValidation:
+		return "Validation"
+	case ClassAccountNotFound:
+		return "AccountNotFound"
+	case ClassNameMismatch:
+		return "NameMismatch"
+	case ClassInsufficientBalance:
+		return "InsufficientBalance"
+	case ClassDuplicateOrder:
+		return "DuplicateOrder"
+	case ClassOrderNotFound:
+		return "OrderNotFound"
+	case ClassPending:
+		return "Pending"
+	}
+	return "Unknown"
+}
+
+// CodeSuccess is the code of a successful request or line.
+const CodeSuccess = "00"
+
+// Sentinel errors of the classes, to be used with errors.Is. They match an
+// *Error whose code is registered in the catalog with their class. This
+// package does not carry the error codes of the partner specification: until
+// they are registered with RegisterCode, the sentinels match no *Error and
+// the Is predicates report false.
+var (
+	ErrInvalidRequest      = &Error{Desc: "invalid request", class: ClassValidation}
+	ErrAuthFailed          = &Error{Desc: "authentication failed", class: ClassAuth}
+	ErrDuplicateOrder      = &Error{Desc: "duplicate order", class: ClassDuplicateOrder}
+	ErrOrderNotFound       = &Error{Desc: "order not found", class: ClassOrderNotFound}
+	ErrAccountNotFound     = &Error{Desc: "account not found", class: ClassAccountNotFound}
+	ErrNameMismatch        = &Error{Desc: "customer name mismatch", class: ClassNameMismatch}
+	ErrInsufficientBalance = &Error{Desc: "insufficient balance", class: ClassInsufficientBalance}
+)
+
+// CodeInfo describes an error code of the catalog.
+type CodeInfo struct {
+	Code      string
+	Class     ErrorClass
+	Message   string
+	MessageVI string
+}
+
+var (
+	catalogMu sync.RWMutex
+	catalog   = map[string]CodeInfo{}
+)
+
+// The catalog holds the codes this package knows to be returned by
+// Viettel, the success code and the batch codes. The error codes of the
+// partner specification are not known here, they are registered by the
+// application with RegisterCode.
+func init() {
+	for _, info := range []CodeInfo{
+		{CodeSuccess, ClassNone, "Success", "Thành công"},
+
+		{ErrBatchWaitDisb.Code, ClassPending, "Waiting for disbursement", "Chờ chi"},
+		{ErrBatchDisbursement.Code, ClassPending, "Disbursing", "Đang chi"},
+		{ErrBatchDisbSuccess.Code, ClassNone, "Disbursed successfully", "Chi thành công"},
+		{ErrBatchDisbFailed.Code, ClassPermanent, "Disbursement failed", "Chi thất bại"},
+		{ErrBatchCancelDisb.Code, ClassPermanent, "Disbursement cancelled", "Hủy chi"},
+		{ErrBatchDisbTimeout.Code, ClassPermanent, "Disbursement timed out", "Hết thời gian chi"},
+	} {
+		catalog[info.Code] = info
+	}
+}
+
+// RegisterCode adds or replaces a code in the catalog, such as the error
+// codes of the partner specification, so that ClassOf, the predicates and
+// the sentinel errors recognize it.
+func RegisterCode(info CodeInfo) {
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	catalog[info.Code] = info
+}
+
+// LookupCode returns the catalog entry of a code.
+func LookupCode(code string) (CodeInfo, bool) {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+
+	info, ok := catalog[code]
+	return info, ok
+}
+
+// ClassOf returns the ErrorClass of the code carried by an *Error or a
+// *BatchError in err's chain. It returns ClassUnknown for a code which is
+// not registered, and the predicates below report false for it, so they
+// must not decide whether an order may be submitted again.
+func ClassOf(err error) ErrorClass {
+	var code string
+	var vtpErr *Error
+	var batchErr *BatchError
+	if errors.As(err, &vtpErr) {
+		code = vtpErr.Code
+	} else if errors.As(err, &batchErr) {
+		code = batchErr.Code
+	} else {
+		return ClassUnknown
+	}
+
+	info, _ := LookupCode(code)
+	return info.Class
+}
+
+// IsRetryable reports whether err carries a code for a temporary failure.
+func IsRetryable(err error) bool {
+	return ClassOf(err) == ClassRetryable
+}
+
+// IsPermanent reports whether err carries a code for a permanent failure.
+func IsPermanent(err error) bool {
+	return ClassOf(err) == ClassPermanent
+}
+
+// IsAuthError reports whether err carries a code for rejected credentials
+// or signatures.
+func IsAuthError(err error) bool {
+	return ClassOf(err) == ClassAuth
+}
+
+// IsValidationError reports whether err carries a code for a malformed
+// request.
+func IsValidationError(err error) bool {
+	return ClassOf(err) == ClassValidation
+}
+
+// IsAccountNotFound reports whether err carries a code for a missing
+// ViettelPay account.
+func IsAccountNotFound(err error) bool {
+	return ClassOf(err) == ClassAccountNotFound
+}
+
+// IsNameMismatch reports whether err carries a code for a customer name
+// which does not match the account.
+func IsNameMismatch(err error) bool {
+	return ClassOf(err) == ClassNameMismatch
+}
+
+// IsInsufficientBalance reports whether err carries a code for an
+// insufficient partner balance.
+func IsInsufficientBalance(err error) bool {
+	return ClassOf(err) == ClassInsufficientBalance
+}
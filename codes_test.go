@@ -0,0 +1,64 @@
+package viettelpay_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	for _, info := range []viettelpay.CodeInfo{
+		{Code: "TEST_ACCOUNT", Class: viettelpay.ClassAccountNotFound},
+		{Code: "TEST_AUTH", Class: viettelpay.ClassAuth},
+		{Code: "TEST_NAME", Class: viettelpay.ClassNameMismatch},
+		{Code: "TEST_SYSTEM", Class: viettelpay.ClassRetryable},
+	} {
+		viettelpay.RegisterCode(info)
+	}
+}
+
+func TestClassOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want viettelpay.ErrorClass
+	}{
+		{"nil", nil, viettelpay.ClassUnknown},
+		{"other", errors.New("boom"), viettelpay.ClassUnknown},
+		{"unknown code", &viettelpay.Error{Code: "XYZ"}, viettelpay.ClassUnknown},
+		{"account not found", &viettelpay.Error{Code: "TEST_ACCOUNT", Desc: "x"}, viettelpay.ClassAccountNotFound},
+		{"wrapped", fmt.Errorf("check: %w", &viettelpay.Error{Code: "TEST_AUTH"}), viettelpay.ClassAuth},
+		{"batch in progress", viettelpay.ErrBatchWaitDisb, viettelpay.ClassPending},
+		{"batch failed", viettelpay.ErrBatchDisbFailed, viettelpay.ClassPermanent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, viettelpay.ClassOf(tt.err))
+		})
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	err := fmt.Errorf("check: %w", &viettelpay.Error{Code: "TEST_NAME", Desc: "Tên không khớp"})
+
+	assert.True(t, errors.Is(err, viettelpay.ErrNameMismatch))
+	assert.False(t, errors.Is(err, viettelpay.ErrAccountNotFound))
+	assert.True(t, viettelpay.IsNameMismatch(err))
+	assert.False(t, viettelpay.IsRetryable(err))
+	assert.True(t, viettelpay.IsRetryable(&viettelpay.Error{Code: "TEST_SYSTEM"}))
+	assert.False(t, viettelpay.IsRetryable(viettelpay.ErrBatchDisbursement))
+	assert.False(t, errors.Is(&viettelpay.Error{Code: "XYZ"}, viettelpay.ErrNameMismatch))
+	assert.True(t, errors.Is(&viettelpay.Error{Code: "TEST_NAME"}, &viettelpay.Error{Code: "TEST_NAME"}))
+}
+
+func TestRegisterCode(t *testing.T) {
+	viettelpay.RegisterCode(viettelpay.CodeInfo{
+		Code:  "TEST_RETRY",
+		Class: viettelpay.ClassRetryable,
+	})
+
+	assert.True(t, viettelpay.IsRetryable(&viettelpay.Error{Code: "TEST_RETRY"}))
+}
@@ -5,11 +5,10 @@ import (
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha1"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
 )
 
@@ -20,53 +19,109 @@ type KeyStore interface {
 	Encrypt(msg []byte) (string, error)
 }
 
+// ErrNoDecrypter is returned by the Decrypt method of a KeyStore created
+// without a crypto.Decrypter.
+var ErrNoDecrypter = errors.New("viettelpay: KeyStore has no decrypter")
+
 type keyStore struct {
-	partnerPrivateKey *rsa.PrivateKey
-	viettelPublicKey  *rsa.PublicKey
+	signer           crypto.Signer
+	decrypter        crypto.Decrypter
+	viettelPublicKey *rsa.PublicKey
+
+	trustedKeys []TrustedKey
+
+	signScheme   SignatureScheme
+	verifyScheme SignatureScheme
 }
 
-func NewKeyStore(partnerPriKey, viettelPubKey []byte) (_ KeyStore, err error) {
-	keys := &keyStore{}
+// NewKeyStore creates a KeyStore from the partner private key and the
+// Viettel public key. Keys may be PEM or DER encoded, see ParsePrivateKey and
+// ParsePublicKey for the supported formats.
+func NewKeyStore(partnerPriKey, viettelPubKey []byte, opt ...KeyStoreOption) (KeyStore, error) {
+	key, err := ParsePrivateKey(partnerPriKey)
+	if err != nil {
+		return nil, err
+	}
 
-	if keys.partnerPrivateKey, err = x509.ParsePKCS1PrivateKey(partnerPriKey); err != nil {
+	return NewSignerKeyStore(key, key, viettelPubKey, opt...)
+}
+
+// NewSignerKeyStore creates a KeyStore whose partner private key is held
+// outside of the process, such as in a PKCS#11 module or a signing sidecar.
+// The signer and the decrypter must use a RSA key. The decrypter is only
+// needed to decrypt passwords, as the Emulator does, and may be nil.
+func NewSignerKeyStore(signer crypto.Signer, decrypter crypto.Decrypter, viettelPubKey []byte, opt ...KeyStoreOption) (_ KeyStore, err error) {
+	opts := keyStoreOptions{
+		signScheme:   SHA1WithRSA,
+		verifyScheme: SHA1WithRSA,
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+	if err = opts.signScheme.validate(); err != nil {
+		return nil, err
+	}
+	if err = opts.verifyScheme.validate(); err != nil {
 		return nil, err
 	}
 
-	if key, err := x509.ParsePKIXPublicKey(viettelPubKey); err != nil {
+	if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("%w: signer key %T", ErrUnsupportedKey, signer.Public())
+	}
+	if decrypter != nil {
+		if _, ok := decrypter.Public().(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("%w: decrypter key %T", ErrUnsupportedKey, decrypter.Public())
+		}
+	}
+
+	keys := &keyStore{
+		signer:       signer,
+		decrypter:    decrypter,
+		signScheme:   opts.signScheme,
+		verifyScheme: opts.verifyScheme,
+	}
+
+	if keys.viettelPublicKey, err = ParsePublicKey(viettelPubKey); err != nil {
 		return nil, err
-	} else if rsaKey, ok := key.(*rsa.PublicKey); ok {
-		keys.viettelPublicKey = rsaKey
-	} else {
-		return nil, errors.New("invalid key type")
+	}
+
+	keys.trustedKeys = append([]TrustedKey{{Key: keys.viettelPublicKey, NotAfter: opts.notAfter}}, opts.trustedKeys...)
+	for i, k := range keys.trustedKeys {
+		if k.Key == nil {
+			return nil, errors.New("viettelpay: trusted key without public key")
+		}
+		if k.ID == "" {
+			keys.trustedKeys[i].ID = KeyID(k.Key)
+		}
 	}
 
 	return keys, nil
 }
 
 func (s *keyStore) Sign(data []byte) ([]byte, error) {
-	hashed := sha1.Sum(data)
-	return rsa.SignPKCS1v15(rand.Reader, s.partnerPrivateKey, crypto.SHA1, hashed[:])
-}
-
-func (s *keyStore) Verify(data, signature []byte) error {
-	hashed := sha1.Sum(data)
-	return rsa.VerifyPKCS1v15(s.viettelPublicKey, crypto.SHA1, hashed[:], signature)
+	return s.signScheme.sign(s.signer, data)
 }
 
 func (s *keyStore) Decrypt(msg []byte) (string, error) {
-	buf := bytes.NewBuffer(nil)
-	err := Decrypt(buf, bytes.NewReader(msg), len(msg), s.partnerPrivateKey)
+	if s.decrypter == nil {
+		return "", ErrNoDecrypter
+	}
+
+	plaintext, err := io.ReadAll(NewDecrypter(bytes.NewReader(msg), s.decrypter))
 	if err != nil {
 		return "", err
 	}
 
-	return buf.String(), nil
+	return string(plaintext), nil
 }
 
 func (s *keyStore) Encrypt(msg []byte) (string, error) {
 	buf := bytes.NewBuffer(nil)
-	err := Encrypt(buf, bytes.NewReader(msg), len(msg), s.viettelPublicKey)
-	if err != nil {
+	enc := NewEncrypter(buf, s.viettelPublicKey)
+	if _, err := enc.Write(msg); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
 		return "", err
 	}
 
@@ -99,60 +154,24 @@ func GenerateKeysPEM(prvKeyDst, pubKeyDst io.Writer, bits int) error {
 	return err
 }
 
+// Decrypt decrypts srcSize bytes of src into dst.
+//
+// Deprecated: Use NewDecrypter, which does not need the size up front.
 func Decrypt(dst io.Writer, src io.Reader, srcSize int, key *rsa.PrivateKey) error {
-	b64 := base64.NewDecoder(base64.StdEncoding, src)
-
-	b64BlockSize := base64.StdEncoding.EncodedLen(key.Size())
-	iterations := srcSize / b64BlockSize
-
-	ciphertext := make([]byte, base64.StdEncoding.DecodedLen(b64BlockSize))
-	for i := 0; i < iterations; i++ {
-		n, err := b64.Read(ciphertext)
-		if err != nil {
-			return err
-		}
-
-		reverseBytes(ciphertext[:n])
-		plaintext, err := rsa.DecryptPKCS1v15(rand.Reader, key, ciphertext[:n])
-		if err != nil {
-			return err
-		}
-
-		dst.Write(plaintext)
-	}
-
-	return nil
+	_, err := io.Copy(dst, NewDecrypter(io.LimitReader(src, int64(srcSize)), key))
+	return err
 }
 
+// Encrypt encrypts srcSize bytes of src into dst.
+//
+// Deprecated: Use NewEncrypter, which does not need the size up front.
 func Encrypt(dst io.Writer, src io.Reader, srcSize int, key *rsa.PublicKey) error {
-	b64 := base64.NewEncoder(base64.StdEncoding, dst)
-
-	// See EncryptPKCS1v15 description for max length
-	maxLength := key.Size() - 11
-	iterations := srcSize / maxLength
-
-	plaintext := make([]byte, maxLength)
-	for i := 0; i <= iterations; i++ {
-		n, err := src.Read(plaintext)
-		if err != nil {
-			return err
-		}
-
-		ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, key, plaintext[:n])
-		if err != nil {
-			return err
-		}
-
-		reverseBytes(ciphertext)
-		b64.Write(ciphertext)
-
-		// Flush base64 chunk
-		if err = b64.Close(); err != nil {
-			return err
-		}
+	enc := NewEncrypter(dst, key)
+	if _, err := io.Copy(enc, io.LimitReader(src, int64(srcSize))); err != nil {
+		return err
 	}
 
-	return nil
+	return enc.Close()
 }
 
 func reverseBytes(p []byte) {
@@ -13,7 +13,7 @@ import (
 func TestEncryptDecrypt(t *testing.T) {
 	key, err := rsa.GenerateKey(rand.Reader, 1024)
 	if err != nil {
-		t.Errorf("failed to generate key: %w", err)
+		t.Errorf("failed to generate key: %v", err)
 		return
 	}
 
@@ -0,0 +1,41 @@
+package emulator
+
+import (
+	"giautm.dev/viettelpay"
+)
+
+// Error codes returned by the emulator. They are placeholders, not the codes
+// of the partner specification, and they are not registered in the catalog
+// of viettelpay: the sentinel errors and predicates of viettelpay do not
+// recognize them. Tests match them by code, with errors.As.
+const (
+	CodeInvalidRequest      = "INVALID_REQUEST"
+	CodeInvalidSignature    = "INVALID_SIGNATURE"
+	CodeAuthFailed          = "AUTH_FAILED"
+	CodeUnknownCommand      = "UNKNOWN_COMMAND"
+	CodeDuplicateOrder      = "DUPLICATE_ORDER"
+	CodeOrderNotFound       = "ORDER_NOT_FOUND"
+	CodeAccountNotFound     = "ACCOUNT_NOT_FOUND"
+	CodeNameMismatch        = "NAME_MISMATCH"
+	CodeInsufficientBalance = "INSUFFICIENT_BALANCE"
+)
+
+var descriptions = map[string]string{
+	CodeInvalidRequest:      "Dữ liệu yêu cầu không hợp lệ",
+	CodeInvalidSignature:    "Chữ ký không hợp lệ",
+	CodeAuthFailed:          "Thông tin xác thực không hợp lệ",
+	CodeUnknownCommand:      "Lệnh không được hỗ trợ",
+	CodeDuplicateOrder:      "Mã đơn hàng đã tồn tại",
+	CodeOrderNotFound:       "Không tìm thấy đơn hàng",
+	CodeAccountNotFound:     "Thuê bao chưa đăng ký ViettelPay",
+	CodeNameMismatch:        "Tên khách hàng không khớp",
+	CodeInsufficientBalance: "Số dư không đủ",
+}
+
+func description(code string) string {
+	if desc, ok := descriptions[code]; ok {
+		return desc
+	}
+	info, _ := viettelpay.LookupCode(code)
+	return info.MessageVI
+}
@@ -0,0 +1,453 @@
+// Package emulator provides an in-process implementation of the ViettelPay
+// partner API. It speaks the same SOAP `process` operation as the real
+// service, so a PartnerAPI can be pointed at it for tests and local runs.
+package emulator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"giautm.dev/viettelpay"
+)
+
+// Account is a ViettelPay account known to the emulator.
+type Account struct {
+	MSISDN       string `json:"msisdn"`
+	CustomerName string `json:"customerName"`
+	Package      string `json:"package,omitempty"`
+}
+
+// A Option sets options such as credentials, accounts, etc.
+type Option func(*Emulator)
+
+// WithCredentials is an Option to require the given partner credentials.
+// Without it, any username, password and service code are accepted.
+func WithCredentials(username, password, serviceCode string) Option {
+	return func(e *Emulator) {
+		e.username = username
+		e.password = password
+		e.serviceCode = serviceCode
+	}
+}
+
+// WithAccounts is an Option to register ViettelPay accounts. Without it,
+// every MSISDN is treated as an existing account with a matching name.
+func WithAccounts(accounts ...Account) Option {
+	return func(e *Emulator) {
+		for _, a := range accounts {
+			e.accounts[a.MSISDN] = a
+		}
+	}
+}
+
+// WithBalance is an Option to limit the total amount that can be disbursed.
+func WithBalance(amount uint64) Option {
+	return func(e *Emulator) {
+		e.balance = &amount
+	}
+}
+
+// WithPendingQueries is an Option to set how many QueryRequests calls observe
+// a batch as in progress before it reaches its final status. Default is 2.
+func WithPendingQueries(n int) Option {
+	return func(e *Emulator) {
+		e.pendingQueries = n
+	}
+}
+
+// Emulator is a http.Handler implementing the ViettelPay partner API.
+type Emulator struct {
+	keyStore viettelpay.KeyStore
+
+	username    string
+	password    string
+	serviceCode string
+
+	pendingQueries int
+
+	mu       sync.Mutex
+	accounts map[string]Account
+	balance  *uint64
+	orders   map[string]*order
+}
+
+var _ http.Handler = (*Emulator)(nil)
+
+// New creates an Emulator. The keyStore plays the Viettel side: it holds the
+// Viettel private key and the partner public key.
+func New(keyStore viettelpay.KeyStore, opt ...Option) *Emulator {
+	e := &Emulator{
+		keyStore:       keyStore,
+		pendingQueries: 2,
+		accounts:       map[string]Account{},
+		orders:         map[string]*order{},
+	}
+	for _, o := range opt {
+		o(e)
+	}
+
+	return e
+}
+
+// SetBatchStatus forces the batch status of a disbursement order, such as
+// CANCEL_DISB or DISB_TIMEOUT, for the following QueryRequests calls.
+func (e *Emulator) SetBatchStatus(orderID, code string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[orderID]
+	if !ok {
+		return errors.New("emulator: order not found")
+	}
+	o.status, o.forced = code, true
+	return nil
+}
+
+// Disbursements returns the lines accepted or rejected for an order.
+func (e *Emulator) Disbursements(orderID string) []viettelpay.RequestDisbursementResponse {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[orderID]
+	if !ok {
+		return nil
+	}
+	return append([]viettelpay.RequestDisbursementResponse(nil), o.lines...)
+}
+
+type order struct {
+	lines   []viettelpay.RequestDisbursementResponse
+	status  string
+	forced  bool
+	queries int
+}
+
+func (o *order) nextStatus(pending int) string {
+	if !o.forced {
+		switch {
+		case o.queries >= pending:
+			o.status = o.finalStatus()
+		case o.queries == 0:
+			o.status = viettelpay.ErrBatchWaitDisb.Code
+		default:
+			o.status = viettelpay.ErrBatchDisbursement.Code
+		}
+	}
+	o.queries++
+
+	return o.status
+}
+
+func (o *order) finalStatus() string {
+	for _, l := range o.lines {
+		if l.ErrorCode == viettelpay.CodeSuccess {
+			return viettelpay.ErrBatchDisbSuccess.Code
+		}
+	}
+	return viettelpay.ErrBatchDisbFailed.Code
+}
+
+type processRequest struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		Process struct {
+			Cmd       string `xml:"cmd"`
+			Data      string `xml:"data"`
+			Signature string `xml:"signature"`
+		} `xml:"process"`
+	} `xml:"Body"`
+}
+
+type processResponse struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+	Body    struct {
+		Fault   *soapFault     `xml:",omitempty"`
+		Content *processReturn `xml:",omitempty"`
+	} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+}
+
+type processReturn struct {
+	XMLName xml.Name `xml:"http://partnerapi.bankplus.viettel.com/ processResponse"`
+	Return  string   `xml:"return"`
+}
+
+type soapFault struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault"`
+	Code    string   `xml:"faultcode"`
+	String  string   `xml:"faultstring"`
+}
+
+type envelopeRequest struct {
+	viettelpay.EnvelopeBase
+	TotalAmount        uint64 `json:"totalAmount"`
+	TotalTransactions  int    `json:"totalTrans"`
+	TransactionContent string `json:"transContent"`
+	QueryType          string `json:"queryType,omitempty"`
+	QueryData          string `json:"queryData,omitempty"`
+}
+
+// ServeHTTP implements http.Handler.
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req processRequest
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFault(w, "soap:Client", err.Error())
+		return
+	}
+
+	res, err := e.process(req.Body.Process.Cmd, req.Body.Process.Data, req.Body.Process.Signature)
+	if err != nil {
+		writeFault(w, "soap:Server", err.Error())
+		return
+	}
+
+	var resp processResponse
+	resp.Body.Content = &processReturn{Return: res}
+	writeXML(w, http.StatusOK, &resp)
+}
+
+func writeFault(w http.ResponseWriter, code, msg string) {
+	var resp processResponse
+	resp.Body.Fault = &soapFault{Code: code, String: msg}
+	writeXML(w, http.StatusInternalServerError, &resp)
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "text/xml; charset=\"utf-8\"")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+// process handles a single `process` call and returns the signed
+// EnvelopeResponse as JSON.
+func (e *Emulator) process(cmd, data, signature string) (string, error) {
+	resData := viettelpay.EnvelopeResponseData{
+		RequestId: viettelpay.GenOrderID(),
+		TransDate: time.Now().Format("20060102150405"),
+	}
+
+	var env envelopeRequest
+	if err := json.Unmarshal([]byte(data), &env); err != nil {
+		setError(&resData, CodeInvalidRequest)
+		return e.sign(resData)
+	}
+	resData.OrderID = env.OrderID
+	resData.Username = env.Username
+	resData.ServiceCode = env.ServiceCode
+	resData.RealServiceCode = env.ServiceCode
+
+	if sig, err := base64.StdEncoding.DecodeString(signature); err != nil {
+		setError(&resData, CodeInvalidSignature)
+	} else if err = e.keyStore.Verify([]byte(data), sig); err != nil {
+		setError(&resData, CodeInvalidSignature)
+	} else if !e.authenticate(&env) {
+		setError(&resData, CodeAuthFailed)
+	} else {
+		var results interface{}
+		switch cmd {
+		case "VTP305":
+			results, err = e.checkAccount(&env, &resData)
+		case "VTP306":
+			results, err = e.requestDisbursement(&env, &resData)
+		case "VTP307":
+			results, err = e.queryRequests(&env, &resData)
+		default:
+			setError(&resData, CodeUnknownCommand)
+		}
+		if err != nil {
+			setError(&resData, CodeInvalidRequest)
+		} else if results != nil {
+			buf := bytes.NewBuffer(nil)
+			if err = viettelpay.MarshalGzipJSON(buf, results); err != nil {
+				return "", err
+			}
+			resData.Data = buf.Bytes()
+		}
+	}
+
+	return e.sign(resData)
+}
+
+func (e *Emulator) sign(resData viettelpay.EnvelopeResponseData) (string, error) {
+	data, err := json.Marshal(resData)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := e.keyStore.Sign(data)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := json.Marshal(viettelpay.EnvelopeResponse{
+		Data:      data,
+		Signature: signature,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(res), nil
+}
+
+func (e *Emulator) authenticate(env *envelopeRequest) bool {
+	password, err := e.keyStore.Decrypt([]byte(env.Password))
+	if err != nil {
+		return false
+	}
+	if e.username == "" && e.password == "" && e.serviceCode == "" {
+		return true
+	}
+
+	return env.Username == e.username &&
+		password == e.password &&
+		env.ServiceCode == e.serviceCode
+}
+
+func (e *Emulator) checkAccount(env *envelopeRequest, resData *viettelpay.EnvelopeResponseData) (interface{}, error) {
+	var checks []viettelpay.CheckAccount
+	if err := unmarshalData(env, &checks); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	results := make([]viettelpay.CheckAccountResponse, 0, len(checks))
+	for _, c := range checks {
+		r := viettelpay.CheckAccountResponse{CheckAccount: c}
+		r.Package, r.ErrorCode = e.lookupAccount(c)
+		r.ErrorDesc = description(r.ErrorCode)
+		results = append(results, r)
+	}
+
+	setError(resData, viettelpay.CodeSuccess)
+	return results, nil
+}
+
+func (e *Emulator) requestDisbursement(env *envelopeRequest, resData *viettelpay.EnvelopeResponseData) (interface{}, error) {
+	var reqs []viettelpay.RequestDisbursement
+	if err := unmarshalData(env, &reqs); err != nil {
+		return nil, err
+	}
+
+	var total uint64
+	for _, r := range reqs {
+		total += r.Amount
+	}
+	if env.OrderID == "" || len(reqs) == 0 ||
+		env.TotalTransactions != len(reqs) || env.TotalAmount != total {
+		setError(resData, CodeInvalidRequest)
+		return nil, nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.orders[env.OrderID]; ok {
+		setError(resData, CodeDuplicateOrder)
+		return nil, nil
+	}
+	if e.balance != nil && *e.balance < total {
+		setError(resData, CodeInsufficientBalance)
+		return nil, nil
+	}
+
+	o := &order{status: viettelpay.ErrBatchWaitDisb.Code}
+	for _, r := range reqs {
+		l := viettelpay.RequestDisbursementResponse{RequestDisbursement: r}
+		_, l.ErrorCode = e.lookupAccount(r.CheckAccount())
+		if l.ErrorCode == viettelpay.CodeSuccess && e.balance != nil {
+			*e.balance -= r.Amount
+		}
+		l.ErrorDesc = description(l.ErrorCode)
+		o.lines = append(o.lines, l)
+	}
+	e.orders[env.OrderID] = o
+
+	setError(resData, viettelpay.CodeSuccess)
+	return o.lines, nil
+}
+
+func (e *Emulator) queryRequests(env *envelopeRequest, resData *viettelpay.EnvelopeResponseData) (interface{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[env.OrderID]
+	if !ok {
+		setError(resData, CodeOrderNotFound)
+		return nil, nil
+	}
+
+	status := o.nextStatus(e.pendingQueries)
+	results := []viettelpay.QueryRequestsResponse{}
+	for _, l := range o.lines {
+		switch env.QueryType {
+		case viettelpay.QueryByTransaction("").Type():
+			if l.TransactionID != env.QueryData {
+				continue
+			}
+		case viettelpay.QueryByMSISDN("").Type():
+			if l.MSISDN != env.QueryData {
+				continue
+			}
+		}
+
+		r := viettelpay.QueryRequestsResponse{
+			RequestDisbursement: l.RequestDisbursement,
+			ErrorCode:           status,
+		}
+		if l.ErrorCode != viettelpay.CodeSuccess {
+			r.ErrorCode = viettelpay.ErrBatchDisbFailed.Code
+		}
+		r.ErrorMsg = description(r.ErrorCode)
+		results = append(results, r)
+	}
+
+	setError(resData, viettelpay.CodeSuccess)
+	resData.BatchErrorCode = status
+	resData.BatchErrorDesc = description(status)
+	return results, nil
+}
+
+// lookupAccount returns the package and the error code for an account check.
+func (e *Emulator) lookupAccount(c viettelpay.CheckAccount) (string, string) {
+	if len(e.accounts) == 0 {
+		return "", viettelpay.CodeSuccess
+	}
+
+	a, ok := e.accounts[c.MSISDN]
+	if !ok {
+		return "", CodeAccountNotFound
+	}
+	if !strings.EqualFold(strings.TrimSpace(a.CustomerName), strings.TrimSpace(c.CustomerName)) {
+		return a.Package, CodeNameMismatch
+	}
+
+	return a.Package, viettelpay.CodeSuccess
+}
+
+func unmarshalData(env *envelopeRequest, v interface{}) error {
+	if env.Data == nil {
+		return errors.New("emulator: missing data")
+	}
+
+	return viettelpay.UnmarshalGzipJSON(bytes.NewReader(env.Data), v)
+}
+
+func setError(resData *viettelpay.EnvelopeResponseData, code string) {
+	resData.ErrorCode = code
+	resData.ErrorDesc = description(code)
+}
@@ -0,0 +1,113 @@
+package emulator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newServer(t *testing.T, opt ...emulator.Option) (*emulator.Server, viettelpay.PartnerAPI) {
+	t.Helper()
+
+	srv, err := emulator.NewServer(opt...)
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	api, err := srv.PartnerAPI()
+	require.NoError(t, err)
+
+	return srv, api
+}
+
+func TestCheckAccount(t *testing.T) {
+	_, api := newServer(t,
+		emulator.WithCredentials("partner", "secret", "SC"),
+		emulator.WithAccounts(emulator.Account{MSISDN: "84365233899", CustomerName: "Nguyen Van A", Package: "VTP"}),
+	)
+
+	results, err := api.CheckAccount(context.Background(), viettelpay.GenOrderID(),
+		viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "NGUYEN VAN A"},
+		viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Tran Van B"},
+		viettelpay.CheckAccount{MSISDN: "84900000000", CustomerName: "Le Van C"},
+	)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.NoError(t, results[0].Err())
+	assert.Equal(t, "VTP", results[0].Package)
+	assert.Equal(t, emulator.CodeNameMismatch, results[1].ErrorCode)
+	assert.Equal(t, emulator.CodeAccountNotFound, results[2].ErrorCode)
+}
+
+func TestAuthFailed(t *testing.T) {
+	srv, _ := newServer(t, emulator.WithCredentials("partner", "secret", "SC"))
+
+	api, err := srv.PartnerAPI(viettelpay.WithAuth("partner", "wrong", "SC"))
+	require.NoError(t, err)
+
+	_, err = api.CheckAccount(context.Background(), viettelpay.GenOrderID(),
+		viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Nguyen Van A"})
+	var vtpErr *viettelpay.Error
+	require.True(t, errors.As(err, &vtpErr))
+	assert.Equal(t, emulator.CodeAuthFailed, vtpErr.Code)
+}
+
+func TestDisbursement(t *testing.T) {
+	srv, api := newServer(t, emulator.WithPendingQueries(2))
+	ctx := context.Background()
+
+	orderID := viettelpay.GenOrderID()
+	results, err := api.RequestDisbursement(ctx, orderID, "Test",
+		viettelpay.RequestDisbursement{
+			TransactionID: viettelpay.GenOrderID(),
+			MSISDN:        "84365233899",
+			CustomerName:  "Nguyen Van A",
+			Amount:        1000,
+		})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.NoError(t, results[0].Err())
+
+	_, err = api.RequestDisbursement(ctx, orderID, "Test", results[0].RequestDisbursement)
+	var vtpErr *viettelpay.Error
+	require.True(t, errors.As(err, &vtpErr))
+	assert.Equal(t, emulator.CodeDuplicateOrder, vtpErr.Code)
+
+	for _, want := range []*viettelpay.BatchError{
+		viettelpay.ErrBatchWaitDisb,
+		viettelpay.ErrBatchDisbursement,
+		viettelpay.ErrBatchDisbSuccess,
+	} {
+		results, status, err := api.QueryRequests(ctx, orderID, nil)
+		assert.True(t, errors.Is(err, want), "got %v, want %v", err, want)
+		assert.Equal(t, want.Status(), status)
+		assert.Len(t, results, 1)
+	}
+
+	orderID = viettelpay.GenOrderID()
+	_, err = api.RequestDisbursement(ctx, orderID, "Test", results[0].RequestDisbursement)
+	require.NoError(t, err)
+	require.NoError(t, srv.SetBatchStatus(orderID, viettelpay.ErrBatchCancelDisb.Code))
+
+	_, _, err = api.QueryRequests(ctx, orderID, nil)
+	assert.True(t, errors.Is(err, viettelpay.ErrBatchCancelDisb))
+}
+
+func TestInsufficientBalance(t *testing.T) {
+	_, api := newServer(t, emulator.WithBalance(500))
+
+	_, err := api.RequestDisbursement(context.Background(), viettelpay.GenOrderID(), "Test",
+		viettelpay.RequestDisbursement{
+			TransactionID: viettelpay.GenOrderID(),
+			MSISDN:        "84365233899",
+			CustomerName:  "Nguyen Van A",
+			Amount:        1000,
+		})
+	var vtpErr *viettelpay.Error
+	require.True(t, errors.As(err, &vtpErr))
+	assert.Equal(t, emulator.CodeInsufficientBalance, vtpErr.Code)
+}
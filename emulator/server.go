@@ -0,0 +1,109 @@
+package emulator
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"net/http/httptest"
+
+	"giautm.dev/viettelpay"
+)
+
+// Keys holds the DER encoded key pairs of both sides of the partner API.
+type Keys struct {
+	PartnerPrivateKey []byte
+	PartnerPublicKey  []byte
+	ViettelPrivateKey []byte
+	ViettelPublicKey  []byte
+}
+
+// GenerateKeys creates a fresh partner and Viettel key pair.
+func GenerateKeys(bits int) (*Keys, error) {
+	keys := &Keys{}
+
+	partner, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	keys.PartnerPrivateKey = x509.MarshalPKCS1PrivateKey(partner)
+	if keys.PartnerPublicKey, err = x509.MarshalPKIXPublicKey(&partner.PublicKey); err != nil {
+		return nil, err
+	}
+
+	viettel, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	keys.ViettelPrivateKey = x509.MarshalPKCS1PrivateKey(viettel)
+	if keys.ViettelPublicKey, err = x509.MarshalPKIXPublicKey(&viettel.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// PartnerKeyStore returns the KeyStore used by a PartnerAPI.
+func (k *Keys) PartnerKeyStore(opt ...viettelpay.KeyStoreOption) (viettelpay.KeyStore, error) {
+	return viettelpay.NewKeyStore(k.PartnerPrivateKey, k.ViettelPublicKey, opt...)
+}
+
+// EmulatorKeyStore returns the KeyStore used by the Emulator. Its sign
+// scheme is the verify scheme of the partner, and the other way around.
+func (k *Keys) EmulatorKeyStore(opt ...viettelpay.KeyStoreOption) (viettelpay.KeyStore, error) {
+	return viettelpay.NewKeyStore(k.ViettelPrivateKey, k.PartnerPublicKey, opt...)
+}
+
+// Server is an Emulator listening on a system-chosen port on the local
+// loopback interface, for use in end-to-end tests.
+type Server struct {
+	*Emulator
+	HTTP *httptest.Server
+	Keys *Keys
+	URL  string
+}
+
+// NewServer starts and returns a new Server with freshly generated keys and
+// default credentials, which can be overridden by WithCredentials.
+// The caller should call Close when finished, to shut it down.
+func NewServer(opt ...Option) (*Server, error) {
+	keys, err := GenerateKeys(1024)
+	if err != nil {
+		return nil, err
+	}
+
+	keyStore, err := keys.EmulatorKeyStore()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Emulator: New(keyStore, append([]Option{
+			WithCredentials("partner", "partner", "PARTNER"),
+		}, opt...)...),
+		Keys: keys,
+	}
+	s.HTTP = httptest.NewServer(s.Emulator)
+	s.URL = s.HTTP.URL
+
+	return s, nil
+}
+
+// PartnerAPI returns a PartnerAPI talking to the Server, configured with the
+// Server's keys and credentials.
+func (s *Server) PartnerAPI(opt ...viettelpay.Option) (viettelpay.PartnerAPI, error) {
+	keyStore, err := s.Keys.PartnerKeyStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return viettelpay.NewPartnerAPI(s.URL, append([]viettelpay.Option{
+		viettelpay.WithAuth(s.username, s.password, s.serviceCode),
+		viettelpay.WithHTTPClient(s.HTTP.Client()),
+		viettelpay.WithKeyStore(keyStore),
+	}, opt...)...)
+}
+
+// Close shuts down the Server.
+func (s *Server) Close() {
+	s.HTTP.Close()
+}
@@ -30,11 +30,31 @@ func (e BatchError) Error() string {
 type Error struct {
 	Code string `json:"errorCode"`
 	Desc string `json:"errorDesc"`
+
+	// class is set for the sentinel errors, which match the codes of a
+	// class rather than a code.
+	class ErrorClass
 }
 
 var _ error = (*Error)(nil)
 
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.class != ClassUnknown {
+		info, _ := LookupCode(e.Code)
+		return info.Class == t.class
+	}
+
+	return e.Code == t.Code
+}
+
 func (e Error) Error() string {
+	if e.Code == "" {
+		return "ViettelPay: " + e.Desc
+	}
 	if e.Desc != "" {
 		return fmt.Sprintf("ViettelPay(%s): %s", e.Code, e.Desc)
 	}
@@ -0,0 +1,34 @@
+package viettelpay
+
+import "context"
+
+// Invoker sends a Request whose envelope is ready to be signed, and returns
+// the decoded response. The response data is unmarshalled into result.
+type Invoker func(ctx context.Context, req Request, result interface{}) (*EnvelopeResponseData, error)
+
+// Interceptor intercepts a Process call, in the style of gRPC unary
+// interceptors. The envelope of req already carries the credentials. The
+// data of req is marshalled into the envelope, which is then signed, by the
+// invoker. An Interceptor may modify req and its data, or pass another
+// Request to invoker, modify the response or the error, or short-circuit the
+// call by not calling invoker.
+type Interceptor func(ctx context.Context, req Request, result interface{}, invoker Invoker) (*EnvelopeResponseData, error)
+
+// WithInterceptors is an Option to add interceptors around every Process
+// call. The first interceptor is the outermost one.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+func chainInterceptors(interceptors []Interceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, req Request, result interface{}) (*EnvelopeResponseData, error) {
+			return interceptor(ctx, req, result, next)
+		}
+	}
+
+	return invoker
+}
@@ -0,0 +1,84 @@
+package viettelpay_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithInterceptors(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	var calls []string
+	trace := func(name string) viettelpay.Interceptor {
+		return func(ctx context.Context, req viettelpay.Request, result interface{}, invoker viettelpay.Invoker) (*viettelpay.EnvelopeResponseData, error) {
+			calls = append(calls, name+">"+req.Command())
+			res, err := invoker(ctx, req, result)
+			calls = append(calls, name+"<")
+			return res, err
+		}
+	}
+	blocked := errors.New("blocked")
+	block := func(ctx context.Context, req viettelpay.Request, result interface{}, invoker viettelpay.Invoker) (*viettelpay.EnvelopeResponseData, error) {
+		if req.Command() == "VTP306" {
+			return nil, blocked
+		}
+		return invoker(ctx, req, result)
+	}
+	rename := func(ctx context.Context, req viettelpay.Request, result interface{}, invoker viettelpay.Invoker) (*viettelpay.EnvelopeResponseData, error) {
+		res, err := invoker(ctx, req, result)
+		if results, ok := result.(*[]viettelpay.CheckAccountResponse); ok {
+			for i := range *results {
+				(*results)[i].Package = "intercepted"
+			}
+		}
+		return res, err
+	}
+
+	api, err := srv.PartnerAPI(viettelpay.WithInterceptors(trace("a"), trace("b"), block, rename))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	results, err := api.CheckAccount(ctx, viettelpay.GenOrderID(),
+		viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Nguyen Van A"})
+	require.NoError(t, err)
+	assert.Equal(t, "intercepted", results[0].Package)
+
+	_, err = api.RequestDisbursement(ctx, viettelpay.GenOrderID(), "Test", viettelpay.RequestDisbursement{
+		TransactionID: viettelpay.GenOrderID(), MSISDN: "84365233899", CustomerName: "Nguyen Van A", Amount: 1000,
+	})
+	assert.True(t, errors.Is(err, blocked))
+
+	assert.Equal(t, []string{"a>VTP305", "b>VTP305", "b<", "a<", "a>VTP306", "b>VTP306", "b<", "a<"}, calls)
+}
+
+func TestInterceptorRewritesData(t *testing.T) {
+	srv, err := emulator.NewServer(emulator.WithAccounts(
+		emulator.Account{MSISDN: "84365233899", CustomerName: "Nguyen Van A", Package: "VTP"},
+	))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	rewrite := func(ctx context.Context, req viettelpay.Request, result interface{}, invoker viettelpay.Invoker) (*viettelpay.EnvelopeResponseData, error) {
+		checks := append([]viettelpay.CheckAccount(nil), req.Data().([]viettelpay.CheckAccount)...)
+		checks[0].CustomerName = "Nguyen Van A"
+		return invoker(ctx, viettelpay.NewRequest(req.Command(), checks, req.Envelope()), result)
+	}
+
+	api, err := srv.PartnerAPI(viettelpay.WithInterceptors(rewrite))
+	require.NoError(t, err)
+
+	results, err := api.CheckAccount(context.Background(), viettelpay.GenOrderID(),
+		viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Tran Van B"})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.NoError(t, results[0].Err())
+	assert.Equal(t, "Nguyen Van A", results[0].CustomerName)
+}
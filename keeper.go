@@ -0,0 +1,65 @@
+package viettelpay
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+
+	"gocloud.dev/secrets"
+)
+
+// EncryptedKeyPEMType is the PEM block type of a private key encrypted by
+// EncryptPrivateKey.
+const EncryptedKeyPEMType = "VIETTELPAY ENCRYPTED PRIVATE KEY"
+
+// DecryptPrivateKey decrypts a private key with the gocloud secrets keeper
+// at keeperURL, such as "base64key://..." or "gcpkms://...". The driver of
+// the keeper must be imported by the program.
+func DecryptPrivateKey(ctx context.Context, keeperURL string, ciphertext []byte) ([]byte, error) {
+	keeper, err := secrets.OpenKeeper(ctx, keeperURL)
+	if err != nil {
+		return nil, err
+	}
+	defer keeper.Close()
+
+	key, err := keeper.Decrypt(ctx, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("viettelpay: decrypt private key: %w", err)
+	}
+
+	return key, nil
+}
+
+// EncryptPrivateKey encrypts a private key with the gocloud secrets keeper
+// at keeperURL and returns it PEM encoded, ready to be set as
+// VIETTELPAY_PARTNER_PRIVATE_KEY along with
+// VIETTELPAY_PARTNER_PRIVATE_KEY_KEEPER.
+func EncryptPrivateKey(ctx context.Context, keeperURL string, key []byte) ([]byte, error) {
+	keeper, err := secrets.OpenKeeper(ctx, keeperURL)
+	if err != nil {
+		return nil, err
+	}
+	defer keeper.Close()
+
+	ciphertext, err := keeper.Encrypt(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("viettelpay: encrypt private key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  EncryptedKeyPEMType,
+		Bytes: ciphertext,
+	}), nil
+}
+
+// NewKeeperKeyStore creates a KeyStore from a partner private key
+// encrypted with the gocloud secrets keeper at keeperURL. See
+// DecryptPrivateKey and NewKeyStore.
+func NewKeeperKeyStore(ctx context.Context, keeperURL string, encryptedPartnerPriKey, viettelPubKey []byte, opt ...KeyStoreOption) (KeyStore, error) {
+	key, err := DecryptPrivateKey(ctx, keeperURL, encryptedPartnerPriKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeyStore(key, viettelPubKey, opt...)
+}
@@ -0,0 +1,57 @@
+package viettelpay_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/secrets/localsecrets"
+)
+
+func TestKeeperKeyStore(t *testing.T) {
+	ctx := context.Background()
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	secret, err := localsecrets.NewRandomKey()
+	require.NoError(t, err)
+	keeperURL := "base64key://" + base64.URLEncoding.EncodeToString(secret[:])
+
+	encrypted, err := viettelpay.EncryptPrivateKey(ctx, keeperURL, srv.Keys.PartnerPrivateKey)
+	require.NoError(t, err)
+	block, _ := pem.Decode(encrypted)
+	require.NotNil(t, block)
+	assert.Equal(t, viettelpay.EncryptedKeyPEMType, block.Type)
+
+	keyStore, err := viettelpay.NewKeeperKeyStore(ctx, keeperURL, block.Bytes, srv.Keys.ViettelPublicKey)
+	require.NoError(t, err)
+	api, err := srv.PartnerAPI(viettelpay.WithKeyStore(keyStore))
+	require.NoError(t, err)
+	_, err = api.CheckAccount(ctx, "ORDER1", viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Nguyen Van A"})
+	assert.NoError(t, err)
+
+	t.Run("ProvideConfig", func(t *testing.T) {
+		t.Setenv("VIETTELPAY_BASE_URL", constantVar(srv.URL))
+		t.Setenv("VIETTELPAY_PARTNER_PRIVATE_KEY", constantVar(string(encrypted)))
+		t.Setenv("VIETTELPAY_PARTNER_PRIVATE_KEY_KEEPER", constantVar(keeperURL))
+		t.Setenv("VIETTELPAY_VIETTEL_PUBLIC_KEY", constantVar(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: srv.Keys.ViettelPublicKey}))))
+
+		cfg, err := viettelpay.ProvideConfig(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, srv.Keys.PartnerPrivateKey, cfg.PartnerPrivateKey.Bytes())
+	})
+
+	t.Run("wrong keeper", func(t *testing.T) {
+		other, err := localsecrets.NewRandomKey()
+		require.NoError(t, err)
+
+		_, err = viettelpay.NewKeeperKeyStore(ctx, "base64key://"+base64.URLEncoding.EncodeToString(other[:]), block.Bytes, srv.Keys.ViettelPublicKey)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,94 @@
+package viettelpay
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// TrustedKey is a Viettel public key accepted to verify responses.
+type TrustedKey struct {
+	// ID identifies the key in logs and traces. Default is the KeyID of Key.
+	ID  string
+	Key *rsa.PublicKey
+	// NotAfter is the time after which the key is no longer trusted. The
+	// zero value means the key does not expire.
+	NotAfter time.Time
+}
+
+// KeyIDVerifier is implemented by KeyStores able to report which key
+// verified a signature.
+type KeyIDVerifier interface {
+	VerifyKeyID(data, signature []byte) (keyID string, err error)
+}
+
+// KeyID returns the ID of a public key, the first 16 hex digits of the
+// SHA-256 of its PKIX encoding.
+func KeyID(key *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Fingerprint returns the SHA-256 of the PKIX encoding of a public key, as
+// colon separated hex digits, like `openssl dgst -sha256 -c` of the DER
+// public key.
+func Fingerprint(key *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(der)
+	digits := make([]string, len(sum))
+	for i, b := range sum {
+		digits[i] = hex.EncodeToString([]byte{b})
+	}
+	return strings.Join(digits, ":")
+}
+
+// WithTrustedKeys is a KeyStoreOption to accept responses signed by other
+// Viettel public keys than the one given to NewKeyStore, such as the old or
+// the new key during a key rotation. Requests are still encrypted with the
+// key given to NewKeyStore.
+func WithTrustedKeys(keys ...TrustedKey) KeyStoreOption {
+	return func(o *keyStoreOptions) {
+		o.trustedKeys = append(o.trustedKeys, keys...)
+	}
+}
+
+// WithViettelKeyNotAfter is a KeyStoreOption to stop trusting the Viettel
+// public key given to NewKeyStore after t, such as the old key during a key
+// rotation. Requests are still encrypted with it. Default is no expiry.
+func WithViettelKeyNotAfter(t time.Time) KeyStoreOption {
+	return func(o *keyStoreOptions) {
+		o.notAfter = t
+	}
+}
+
+func (s *keyStore) Verify(data, signature []byte) error {
+	_, err := s.VerifyKeyID(data, signature)
+	return err
+}
+
+// VerifyKeyID implements KeyIDVerifier. Expired keys are skipped.
+func (s *keyStore) VerifyKeyID(data, signature []byte) (string, error) {
+	now := time.Now()
+	for _, k := range s.trustedKeys {
+		if !k.NotAfter.IsZero() && now.After(k.NotAfter) {
+			continue
+		}
+		if s.verifyScheme.verify(k.Key, data, signature) == nil {
+			return k.ID, nil
+		}
+	}
+
+	return "", rsa.ErrVerification
+}
@@ -0,0 +1,122 @@
+package viettelpay_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedKeys(t *testing.T) {
+	oldKeys, err := emulator.GenerateKeys(1024)
+	require.NoError(t, err)
+	newKeys, err := emulator.GenerateKeys(1024)
+	require.NoError(t, err)
+
+	newPub, err := viettelpay.ParsePublicKey(newKeys.ViettelPublicKey)
+	require.NoError(t, err)
+	oldPub, err := viettelpay.ParsePublicKey(oldKeys.ViettelPublicKey)
+	require.NoError(t, err)
+
+	data := []byte(`{"orderId":"ORDER1"}`)
+	sign := func(viettelPriKey []byte) []byte {
+		ks, err := viettelpay.NewKeyStore(viettelPriKey, newKeys.PartnerPublicKey)
+		require.NoError(t, err)
+		sig, err := ks.Sign(data)
+		require.NoError(t, err)
+		return sig
+	}
+	oldSig, newSig := sign(oldKeys.ViettelPrivateKey), sign(newKeys.ViettelPrivateKey)
+
+	t.Run("rotation", func(t *testing.T) {
+		ks, err := viettelpay.NewKeyStore(oldKeys.PartnerPrivateKey, oldKeys.ViettelPublicKey,
+			viettelpay.WithTrustedKeys(viettelpay.TrustedKey{ID: "2025", Key: newPub}))
+		require.NoError(t, err)
+		v := ks.(viettelpay.KeyIDVerifier)
+
+		id, err := v.VerifyKeyID(data, oldSig)
+		require.NoError(t, err)
+		assert.Equal(t, viettelpay.KeyID(oldPub), id)
+
+		id, err = v.VerifyKeyID(data, newSig)
+		require.NoError(t, err)
+		assert.Equal(t, "2025", id)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		ks, err := viettelpay.NewKeyStore(newKeys.PartnerPrivateKey, newKeys.ViettelPublicKey,
+			viettelpay.WithTrustedKeys(viettelpay.TrustedKey{Key: oldPub, NotAfter: time.Now().Add(-time.Minute)}))
+		require.NoError(t, err)
+
+		assert.NoError(t, ks.Verify(data, newSig))
+		assert.True(t, errors.Is(ks.Verify(data, oldSig), rsa.ErrVerification))
+	})
+
+	t.Run("expired primary", func(t *testing.T) {
+		ks, err := viettelpay.NewKeyStore(oldKeys.PartnerPrivateKey, oldKeys.ViettelPublicKey,
+			viettelpay.WithViettelKeyNotAfter(time.Now().Add(-time.Minute)),
+			viettelpay.WithTrustedKeys(viettelpay.TrustedKey{Key: newPub}))
+		require.NoError(t, err)
+
+		assert.NoError(t, ks.Verify(data, newSig))
+		assert.True(t, errors.Is(ks.Verify(data, oldSig), rsa.ErrVerification))
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, err := viettelpay.NewKeyStore(newKeys.PartnerPrivateKey, newKeys.ViettelPublicKey,
+			viettelpay.WithTrustedKeys(viettelpay.TrustedKey{ID: "empty"}))
+		assert.Error(t, err)
+	})
+}
+
+func TestTrustedKeysResponse(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// The partner still trusts the old key, the emulator signs with the new
+	// one.
+	oldKeys, err := emulator.GenerateKeys(1024)
+	require.NoError(t, err)
+	oldPub, err := viettelpay.ParsePublicKey(oldKeys.ViettelPublicKey)
+	require.NoError(t, err)
+	newPub, err := viettelpay.ParsePublicKey(srv.Keys.ViettelPublicKey)
+	require.NoError(t, err)
+	keyStore, err := viettelpay.NewKeyStore(srv.Keys.PartnerPrivateKey, srv.Keys.ViettelPublicKey,
+		viettelpay.WithTrustedKeys(viettelpay.TrustedKey{ID: "old", Key: oldPub}))
+	require.NoError(t, err)
+
+	var keyID string
+	api, err := srv.PartnerAPI(
+		viettelpay.WithKeyStore(keyStore),
+		viettelpay.WithInterceptors(func(ctx context.Context, req viettelpay.Request, result interface{}, invoker viettelpay.Invoker) (*viettelpay.EnvelopeResponseData, error) {
+			res, err := invoker(ctx, req, result)
+			if res != nil {
+				keyID = res.KeyID
+			}
+			return res, err
+		}),
+	)
+	require.NoError(t, err)
+
+	_, err = api.CheckAccount(context.Background(), "ORDER1", viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Nguyen Van A"})
+	require.NoError(t, err)
+	assert.Equal(t, viettelpay.KeyID(newPub), keyID)
+}
+
+func TestFingerprint(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	fp := viettelpay.Fingerprint(&key.PublicKey)
+	assert.Len(t, fp, 32*3-1)
+	assert.True(t, strings.HasPrefix(strings.ReplaceAll(fp, ":", ""), viettelpay.KeyID(&key.PublicKey)))
+}
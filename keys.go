@@ -0,0 +1,170 @@
+package viettelpay
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeyFormat is an encoding of a RSA key.
+type KeyFormat string
+
+// Key formats detected by ParsePrivateKey and ParsePublicKey.
+const (
+	KeyFormatPKCS1       KeyFormat = "PKCS#1"
+	KeyFormatPKCS8       KeyFormat = "PKCS#8"
+	KeyFormatPKIX        KeyFormat = "PKIX"
+	KeyFormatCertificate KeyFormat = "X.509 certificate"
+)
+
+// PEM block types of the private keys read by ParsePrivateKey.
+const (
+	PrivateKeyPEMType          = "PRIVATE KEY"
+	RSAPrivateKeyPEMType       = "RSA PRIVATE KEY"
+	EncryptedPrivateKeyPEMType = "ENCRYPTED PRIVATE KEY"
+)
+
+// ErrUnsupportedKey is returned when a key is well-formed but is not a RSA
+// key, or is wrapped in an unsupported PEM block.
+var ErrUnsupportedKey = errors.New("viettelpay: unsupported key")
+
+// ErrEncryptedKey is returned by ParsePrivateKey for a PKCS#8 key encrypted
+// with a passphrase, which it does not decrypt.
+var ErrEncryptedKey = errors.New("viettelpay: encrypted key, a passphrase is required")
+
+// KeyFormatError is returned when a key can not be parsed in any of the
+// formats it was tried as.
+type KeyFormatError struct {
+	// Kind is either "private key" or "public key".
+	Kind    string
+	Formats []KeyFormat
+	Err     error
+}
+
+var _ error = (*KeyFormatError)(nil)
+
+func (e *KeyFormatError) Error() string {
+	formats := make([]string, len(e.Formats))
+	for i, f := range e.Formats {
+		formats[i] = string(f)
+	}
+
+	return fmt.Sprintf("viettelpay: invalid %s, tried %s: %v",
+		e.Kind, strings.Join(formats, ", "), e.Err)
+}
+
+func (e *KeyFormatError) Unwrap() error {
+	return e.Err
+}
+
+// ParsePrivateKey parses a RSA private key in PKCS#1 or PKCS#8 form, either
+// PEM or DER encoded.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	formats := []KeyFormat{KeyFormatPKCS1, KeyFormatPKCS8}
+	if block, _ := pem.Decode(data); block != nil {
+		switch block.Type {
+		case RSAPrivateKeyPEMType:
+			formats = []KeyFormat{KeyFormatPKCS1}
+		case PrivateKeyPEMType:
+			formats = []KeyFormat{KeyFormatPKCS8}
+		case EncryptedPrivateKeyPEMType:
+			return nil, &KeyFormatError{
+				Kind:    "private key",
+				Formats: []KeyFormat{KeyFormatPKCS8},
+				Err:     ErrEncryptedKey,
+			}
+		default:
+			return nil, &KeyFormatError{
+				Kind:    "private key",
+				Formats: formats,
+				Err:     fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type),
+			}
+		}
+		data = block.Bytes
+	}
+
+	var errs []error
+	for _, f := range formats {
+		var key interface{}
+		var err error
+		switch f {
+		case KeyFormatPKCS1:
+			key, err = x509.ParsePKCS1PrivateKey(data)
+		case KeyFormatPKCS8:
+			key, err = x509.ParsePKCS8PrivateKey(data)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+		return nil, &KeyFormatError{
+			Kind:    "private key",
+			Formats: []KeyFormat{f},
+			Err:     fmt.Errorf("%w: %T", ErrUnsupportedKey, key),
+		}
+	}
+
+	return nil, &KeyFormatError{Kind: "private key", Formats: formats, Err: errors.Join(errs...)}
+}
+
+// ParsePublicKey parses a RSA public key in PKIX or PKCS#1 form, or the key
+// of a X.509 certificate, either PEM or DER encoded.
+func ParsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	formats := []KeyFormat{KeyFormatPKIX, KeyFormatPKCS1, KeyFormatCertificate}
+	if block, _ := pem.Decode(data); block != nil {
+		switch block.Type {
+		case "PUBLIC KEY":
+			formats = []KeyFormat{KeyFormatPKIX}
+		case "RSA PUBLIC KEY":
+			formats = []KeyFormat{KeyFormatPKCS1}
+		case "CERTIFICATE":
+			formats = []KeyFormat{KeyFormatCertificate}
+		default:
+			return nil, &KeyFormatError{
+				Kind:    "public key",
+				Formats: formats,
+				Err:     fmt.Errorf("%w: PEM block %q", ErrUnsupportedKey, block.Type),
+			}
+		}
+		data = block.Bytes
+	}
+
+	var errs []error
+	for _, f := range formats {
+		var key interface{}
+		var err error
+		switch f {
+		case KeyFormatPKIX:
+			key, err = x509.ParsePKIXPublicKey(data)
+		case KeyFormatPKCS1:
+			key, err = x509.ParsePKCS1PublicKey(data)
+		case KeyFormatCertificate:
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(data); err == nil {
+				key = cert.PublicKey
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+		return nil, &KeyFormatError{
+			Kind:    "public key",
+			Formats: []KeyFormat{f},
+			Err:     fmt.Errorf("%w: %T", ErrUnsupportedKey, key),
+		}
+	}
+
+	return nil, &KeyFormatError{Kind: "public key", Formats: formats, Err: errors.Join(errs...)}
+}
@@ -0,0 +1,108 @@
+package viettelpay_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"giautm.dev/viettelpay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	pkcs1 := x509.MarshalPKCS1PrivateKey(key)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	for name, data := range map[string][]byte{
+		"PKCS#1 DER": pkcs1,
+		"PKCS#8 DER": pkcs8,
+		"PKCS#1 PEM": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs1}),
+		"PKCS#8 PEM": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := viettelpay.ParsePrivateKey(data)
+			require.NoError(t, err)
+			assert.True(t, key.Equal(got))
+		})
+	}
+
+	t.Run("wrong PEM content", func(t *testing.T) {
+		_, err := viettelpay.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs1}))
+		var formatErr *viettelpay.KeyFormatError
+		require.True(t, errors.As(err, &formatErr))
+		assert.Equal(t, []viettelpay.KeyFormat{viettelpay.KeyFormatPKCS8}, formatErr.Formats)
+		assert.Contains(t, err.Error(), "PKCS#8")
+	})
+
+	t.Run("not RSA", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+		require.NoError(t, err)
+
+		_, err = viettelpay.ParsePrivateKey(der)
+		assert.True(t, errors.Is(err, viettelpay.ErrUnsupportedKey))
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		_, err := viettelpay.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: pkcs8}))
+		assert.True(t, errors.Is(err, viettelpay.ErrEncryptedKey))
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		_, err := viettelpay.ParsePrivateKey([]byte("garbage"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "viettelpay: invalid private key, tried PKCS#1, PKCS#8: ")
+	})
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	pkix1, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	pkcs1 := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ViettelPay"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	for name, data := range map[string][]byte{
+		"PKIX DER":        pkix1,
+		"PKCS#1 DER":      pkcs1,
+		"certificate DER": cert,
+		"PKIX PEM":        pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix1}),
+		"PKCS#1 PEM":      pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: pkcs1}),
+		"certificate PEM": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := viettelpay.ParsePublicKey(data)
+			require.NoError(t, err)
+			assert.True(t, key.PublicKey.Equal(got))
+		})
+	}
+
+	t.Run("unsupported PEM block", func(t *testing.T) {
+		_, err := viettelpay.ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs1}))
+		assert.True(t, errors.Is(err, viettelpay.ErrUnsupportedKey))
+		assert.Contains(t, err.Error(), `"RSA PRIVATE KEY"`)
+	})
+}
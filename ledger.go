@@ -0,0 +1,342 @@
+package viettelpay
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ledgerWriteTimeout bounds the write of the outcome of a VTP306 call,
+// which is made on a context detached from the one of the call.
+const ledgerWriteTimeout = 10 * time.Second
+
+var (
+	ErrLedgerNotFound  = errors.New("viettelpay: order not found in ledger")
+	ErrLedgerDuplicate = errors.New("viettelpay: order already exists in ledger")
+	ErrLedgerMismatch  = errors.New("viettelpay: order does not match the one in ledger")
+)
+
+// LedgerState is the state of a disbursement order or line in a Ledger.
+type LedgerState string
+
+const (
+	// LedgerIntent is recorded before the order is submitted.
+	LedgerIntent LedgerState = "INTENT"
+	// LedgerSubmitted is recorded right before the VTP306 call. An order
+	// left in this state was interrupted before the response was recorded.
+	LedgerSubmitted LedgerState = "SUBMITTED"
+	// LedgerUnknown is recorded when the VTP306 call failed without a
+	// response from Viettel, the order may or may not have been accepted.
+	// It is also recorded when Viettel replied the orderID already exists,
+	// the order must then be reconciled with QueryRequests.
+	LedgerUnknown LedgerState = "UNKNOWN"
+	// LedgerAccepted is recorded when Viettel accepted the order or line.
+	LedgerAccepted LedgerState = "ACCEPTED"
+	// LedgerRejected is recorded when Viettel rejected the order or line.
+	LedgerRejected LedgerState = "REJECTED"
+	// LedgerSucceeded is recorded when the order or line was disbursed.
+	LedgerSucceeded LedgerState = "SUCCEEDED"
+	// LedgerFailed is recorded when the order or line was not disbursed.
+	LedgerFailed LedgerState = "FAILED"
+)
+
+// IsFinal reports whether the state will not change anymore.
+func (s LedgerState) IsFinal() bool {
+	switch s {
+	case LedgerRejected, LedgerSucceeded, LedgerFailed:
+		return true
+	}
+	return false
+}
+
+// LedgerEntry is a RequestDisbursement line recorded in a Ledger.
+type LedgerEntry struct {
+	RequestDisbursement
+	OrderID   string
+	State     LedgerState
+	ErrorCode string
+	ErrorDesc string
+}
+
+// LedgerOrder is a RequestDisbursement order recorded in a Ledger.
+type LedgerOrder struct {
+	OrderID            string
+	TransactionContent string
+	State              LedgerState
+	BatchStatus        BatchStatus
+	ErrorCode          string
+	ErrorDesc          string
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+
+	Entries []LedgerEntry
+}
+
+// Ledger persists disbursement orders, so the outcome of an order can be
+// recovered after a crash between submitting it and receiving the response.
+type Ledger interface {
+	// Create records a new order and its entries. It returns
+	// ErrLedgerDuplicate if the order, or the transId of an entry, already
+	// exists.
+	Create(ctx context.Context, order *LedgerOrder) error
+	// Update replaces a recorded order and its entries. It returns
+	// ErrLedgerNotFound if the order does not exist.
+	Update(ctx context.Context, order *LedgerOrder) error
+	// Order returns a recorded order, or ErrLedgerNotFound.
+	Order(ctx context.Context, orderID string) (*LedgerOrder, error)
+	// Transaction returns a recorded entry by transId, or ErrLedgerNotFound.
+	Transaction(ctx context.Context, transactionID string) (*LedgerEntry, error)
+	// Unfinished returns the orders which are not in a final state.
+	Unfinished(ctx context.Context) ([]*LedgerOrder, error)
+}
+
+// WithLedger is an Option to record every RequestDisbursement and
+// QueryRequests call in a Ledger
+func WithLedger(ledger Ledger) Option {
+	return func(o *options) {
+		o.ledger = ledger
+	}
+}
+
+func newLedgerOrder(orderID, transactionContent string, reqs []RequestDisbursement) *LedgerOrder {
+	now := time.Now()
+	order := &LedgerOrder{
+		OrderID:            orderID,
+		TransactionContent: transactionContent,
+		State:              LedgerIntent,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	for _, r := range reqs {
+		order.Entries = append(order.Entries, LedgerEntry{
+			RequestDisbursement: r,
+			OrderID:             orderID,
+			State:               LedgerIntent,
+		})
+	}
+
+	return order
+}
+
+func (o *LedgerOrder) setState(state LedgerState) {
+	o.State = state
+	o.UpdatedAt = time.Now()
+	for i := range o.Entries {
+		o.Entries[i].State = state
+	}
+}
+
+// applyResponse records the outcome of a VTP306 call. An error answer to a
+// resubmitted order may mean that a previous submission reached Viettel, so
+// the order is left UNKNOWN until it is reconciled.
+func (o *LedgerOrder) applyResponse(results []RequestDisbursementResponse, err error, resubmitted bool) {
+	var vtpErr *Error
+	if errors.As(err, &vtpErr) {
+		state := LedgerRejected
+		if resubmitted {
+			state = LedgerUnknown
+		}
+		o.setState(state)
+		o.ErrorCode, o.ErrorDesc = vtpErr.Code, vtpErr.Desc
+	} else if err != nil {
+		o.setState(LedgerUnknown)
+		o.ErrorCode, o.ErrorDesc = "", err.Error()
+	} else {
+		o.setState(LedgerAccepted)
+		o.ErrorCode, o.ErrorDesc = CodeSuccess, ""
+	}
+
+	for _, r := range results {
+		if e := o.entry(r.TransactionID); e != nil {
+			e.ErrorCode, e.ErrorDesc = r.ErrorCode, r.ErrorDesc
+			if r.Err() != nil {
+				e.State = LedgerRejected
+			}
+		}
+	}
+}
+
+// applyQuery records the outcome of a VTP307 call.
+func (o *LedgerOrder) applyQuery(results []QueryRequestsResponse, status BatchStatus) {
+	if status == BatchUnknown {
+		return
+	}
+
+	// A batch status means the order was accepted, even if the response
+	// of the submission was lost.
+	o.State = LedgerAccepted
+	o.BatchStatus = status
+	o.UpdatedAt = time.Now()
+	if status.IsFinal() {
+		o.State = LedgerFailed
+		if status == BatchSucceeded {
+			o.State = LedgerSucceeded
+		}
+	}
+
+	for _, r := range results {
+		e := o.entry(r.TransactionID)
+		if e == nil {
+			continue
+		}
+
+		e.ErrorCode, e.ErrorDesc = r.ErrorCode, r.ErrorMsg
+		switch s := ParseBatchStatus(r.ErrorCode); {
+		case s == BatchSucceeded:
+			e.State = LedgerSucceeded
+		case s.IsFinal():
+			e.State = LedgerFailed
+		case e.State == LedgerIntent, e.State == LedgerSubmitted, e.State == LedgerUnknown:
+			e.State = LedgerAccepted
+		}
+	}
+}
+
+// matches reports whether reqs are the lines the order was recorded with.
+func (o *LedgerOrder) matches(reqs []RequestDisbursement) bool {
+	if len(o.Entries) != len(reqs) {
+		return false
+	}
+	for i, r := range reqs {
+		e := o.Entries[i]
+		if e.TransactionID != r.TransactionID || e.MSISDN != r.MSISDN || e.Amount != r.Amount {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *LedgerOrder) entry(transactionID string) *LedgerEntry {
+	for i := range o.Entries {
+		if o.Entries[i].TransactionID == transactionID {
+			return &o.Entries[i]
+		}
+	}
+	return nil
+}
+
+func (o *LedgerOrder) clone() *LedgerOrder {
+	c := *o
+	c.Entries = append([]LedgerEntry(nil), o.Entries...)
+	return &c
+}
+
+// beginDisbursement records the intent and the submission of an order. An
+// order may be submitted again only while its outcome is not known, and
+// only with the lines it was recorded with; resubmitted reports that case.
+func (s *partnerAPI) beginDisbursement(ctx context.Context, orderID, transactionContent string, reqs []RequestDisbursement) (order *LedgerOrder, resubmitted bool, err error) {
+	order, err = s.ledger.Order(ctx, orderID)
+	if errors.Is(err, ErrLedgerNotFound) {
+		order = newLedgerOrder(orderID, transactionContent, reqs)
+		if err = s.ledger.Create(ctx, order); err != nil {
+			return nil, false, err
+		}
+	} else if err != nil {
+		return nil, false, err
+	} else if order.State != LedgerIntent && order.State != LedgerSubmitted && order.State != LedgerUnknown {
+		return nil, false, ErrLedgerDuplicate
+	} else if !order.matches(reqs) {
+		return nil, false, ErrLedgerMismatch
+	} else {
+		resubmitted = true
+	}
+
+	order.setState(LedgerSubmitted)
+	if err = s.ledger.Update(ctx, order); err != nil {
+		return nil, false, err
+	}
+
+	return order, resubmitted, nil
+}
+
+type memoryLedger struct {
+	mu     sync.Mutex
+	orders map[string]*LedgerOrder
+	trans  map[string]string
+}
+
+// NewMemoryLedger returns a Ledger keeping orders in memory, for tests and
+// short-lived processes.
+func NewMemoryLedger() Ledger {
+	return &memoryLedger{
+		orders: map[string]*LedgerOrder{},
+		trans:  map[string]string{},
+	}
+}
+
+func (l *memoryLedger) Create(ctx context.Context, order *LedgerOrder) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.orders[order.OrderID]; ok {
+		return ErrLedgerDuplicate
+	}
+	for _, e := range order.Entries {
+		if _, ok := l.trans[e.TransactionID]; ok {
+			return ErrLedgerDuplicate
+		}
+	}
+	l.put(order)
+	return nil
+}
+
+func (l *memoryLedger) Update(ctx context.Context, order *LedgerOrder) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.orders[order.OrderID]; !ok {
+		return ErrLedgerNotFound
+	}
+	l.put(order)
+	return nil
+}
+
+func (l *memoryLedger) put(order *LedgerOrder) {
+	l.orders[order.OrderID] = order.clone()
+	for _, e := range order.Entries {
+		l.trans[e.TransactionID] = order.OrderID
+	}
+}
+
+func (l *memoryLedger) Order(ctx context.Context, orderID string) (*LedgerOrder, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	order, ok := l.orders[orderID]
+	if !ok {
+		return nil, ErrLedgerNotFound
+	}
+	return order.clone(), nil
+}
+
+func (l *memoryLedger) Transaction(ctx context.Context, transactionID string) (*LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if order, ok := l.orders[l.trans[transactionID]]; ok {
+		if e := order.entry(transactionID); e != nil {
+			entry := *e
+			return &entry, nil
+		}
+	}
+	return nil, ErrLedgerNotFound
+}
+
+func (l *memoryLedger) Unfinished(ctx context.Context) ([]*LedgerOrder, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	orders := []*LedgerOrder{}
+	for _, order := range l.orders {
+		if !order.State.IsFinal() {
+			orders = append(orders, order.clone())
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+
+	return orders, nil
+}
@@ -0,0 +1,170 @@
+package viettelpay_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedger(t *testing.T) {
+	srv, err := emulator.NewServer(
+		emulator.WithPendingQueries(1),
+		emulator.WithAccounts(emulator.Account{MSISDN: "84365233899", CustomerName: "Nguyen Van A"}),
+	)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	ledger := viettelpay.NewMemoryLedger()
+	api, err := srv.PartnerAPI(viettelpay.WithLedger(ledger))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	orderID := viettelpay.GenOrderID()
+	reqs := []viettelpay.RequestDisbursement{
+		{TransactionID: viettelpay.GenOrderID(), MSISDN: "84365233899", CustomerName: "Nguyen Van A", Amount: 1000},
+		{TransactionID: viettelpay.GenOrderID(), MSISDN: "84900000000", CustomerName: "Le Van C", Amount: 2000},
+	}
+	_, err = api.RequestDisbursement(ctx, orderID, "Test", reqs...)
+	require.NoError(t, err)
+
+	order, err := ledger.Order(ctx, orderID)
+	require.NoError(t, err)
+	assert.Equal(t, viettelpay.LedgerAccepted, order.State)
+	require.Len(t, order.Entries, 2)
+	assert.Equal(t, viettelpay.LedgerAccepted, order.Entries[0].State)
+	assert.Equal(t, viettelpay.LedgerRejected, order.Entries[1].State)
+	assert.Equal(t, emulator.CodeAccountNotFound, order.Entries[1].ErrorCode)
+
+	unfinished, err := ledger.Unfinished(ctx)
+	require.NoError(t, err)
+	assert.Len(t, unfinished, 1)
+
+	_, err = api.RequestDisbursement(ctx, orderID, "Test", reqs...)
+	assert.True(t, errors.Is(err, viettelpay.ErrLedgerDuplicate))
+	_, err = api.RequestDisbursement(ctx, viettelpay.GenOrderID(), "Test", reqs...)
+	assert.True(t, errors.Is(err, viettelpay.ErrLedgerDuplicate), "transId reused by another order")
+
+	for i := 0; i < 2; i++ {
+		_, _, _ = api.QueryRequests(ctx, orderID, nil)
+	}
+
+	entry, err := ledger.Transaction(ctx, reqs[0].TransactionID)
+	require.NoError(t, err)
+	assert.Equal(t, orderID, entry.OrderID)
+	assert.Equal(t, viettelpay.LedgerSucceeded, entry.State)
+
+	order, err = ledger.Order(ctx, orderID)
+	require.NoError(t, err)
+	assert.Equal(t, viettelpay.LedgerSucceeded, order.State)
+	assert.Equal(t, viettelpay.BatchSucceeded, order.BatchStatus)
+
+	unfinished, err = ledger.Unfinished(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, unfinished)
+}
+
+func TestLedgerDuplicateOrder(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	ctx := context.Background()
+	orderID := viettelpay.GenOrderID()
+	reqs := []viettelpay.RequestDisbursement{
+		{TransactionID: viettelpay.GenOrderID(), MSISDN: "84365233899", CustomerName: "Nguyen Van A", Amount: 1000},
+	}
+
+	// The response of the first submission was lost.
+	plain, err := srv.PartnerAPI()
+	require.NoError(t, err)
+	_, err = plain.RequestDisbursement(ctx, orderID, "Test", reqs...)
+	require.NoError(t, err)
+
+	ledger := viettelpay.NewMemoryLedger()
+	require.NoError(t, ledger.Create(ctx, &viettelpay.LedgerOrder{
+		OrderID: orderID,
+		State:   viettelpay.LedgerUnknown,
+		Entries: []viettelpay.LedgerEntry{{RequestDisbursement: reqs[0], OrderID: orderID, State: viettelpay.LedgerUnknown}},
+	}))
+	api, err := srv.PartnerAPI(viettelpay.WithLedger(ledger))
+	require.NoError(t, err)
+
+	// The order may only be submitted again with the same lines.
+	changed := []viettelpay.RequestDisbursement{reqs[0]}
+	changed[0].Amount = 2000
+	_, err = api.RequestDisbursement(ctx, orderID, "Test", changed...)
+	assert.True(t, errors.Is(err, viettelpay.ErrLedgerMismatch))
+
+	// Any error answer to a resubmission leaves the order to be reconciled.
+	_, err = api.RequestDisbursement(ctx, orderID, "Test", reqs...)
+	var vtpErr *viettelpay.Error
+	require.True(t, errors.As(err, &vtpErr))
+	assert.Equal(t, emulator.CodeDuplicateOrder, vtpErr.Code)
+
+	order, err := ledger.Order(ctx, orderID)
+	require.NoError(t, err)
+	assert.Equal(t, viettelpay.LedgerUnknown, order.State)
+
+	_, status, _ := api.QueryRequests(ctx, orderID, nil)
+	assert.Equal(t, viettelpay.BatchPending, status)
+	order, err = ledger.Order(ctx, orderID)
+	require.NoError(t, err)
+	assert.Equal(t, viettelpay.LedgerAccepted, order.State)
+}
+
+// cancelLedger cancels the context of the call once the order is recorded
+// as submitted, and fails the writes made on a done context.
+type cancelLedger struct {
+	viettelpay.Ledger
+	cancel context.CancelFunc
+	err    error
+}
+
+func (l *cancelLedger) Update(ctx context.Context, order *viettelpay.LedgerOrder) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if order.State == viettelpay.LedgerSubmitted {
+		defer l.cancel()
+	} else if l.err != nil {
+		return l.err
+	}
+	return l.Ledger.Update(ctx, order)
+}
+
+func TestLedgerDetachedUpdate(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ledger := &cancelLedger{Ledger: viettelpay.NewMemoryLedger(), cancel: cancel}
+	api, err := srv.PartnerAPI(viettelpay.WithLedger(ledger))
+	require.NoError(t, err)
+
+	orderID := viettelpay.GenOrderID()
+	reqs := []viettelpay.RequestDisbursement{
+		{TransactionID: viettelpay.GenOrderID(), MSISDN: "84365233899", CustomerName: "Nguyen Van A", Amount: 1000},
+	}
+	_, err = api.RequestDisbursement(ctx, orderID, "Test", reqs...)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	order, err := ledger.Order(context.Background(), orderID)
+	require.NoError(t, err)
+	assert.Equal(t, viettelpay.LedgerUnknown, order.State)
+
+	t.Run("write error", func(t *testing.T) {
+		ledger.cancel = func() {}
+		ledger.err = errors.New("disk full")
+
+		reqs[0].TransactionID = viettelpay.GenOrderID()
+		_, err := api.RequestDisbursement(context.Background(), viettelpay.GenOrderID(), "Test", reqs...)
+		assert.True(t, errors.Is(err, ledger.err))
+	})
+}
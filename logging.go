@@ -0,0 +1,202 @@
+package viettelpay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const redacted = "[REDACTED]"
+
+// WithLogger is an Option to log every Process call. MSISDNs, customer
+// names, passwords and signatures are masked.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// MaskMSISDN masks all but the first 2 and the last 3 digits of an MSISDN.
+func MaskMSISDN(msisdn string) string {
+	if len(msisdn) <= 5 {
+		return strings.Repeat("*", len(msisdn))
+	}
+	return msisdn[:2] + strings.Repeat("*", len(msisdn)-5) + msisdn[len(msisdn)-3:]
+}
+
+// MaskName masks all but the first letter of each word of a name.
+func MaskName(name string) string {
+	words := strings.Fields(name)
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = string(r) + strings.Repeat("*", utf8.RuneCountInString(w[size:]))
+	}
+	return strings.Join(words, " ")
+}
+
+// LogValue implements slog.LogValuer.
+func (c CheckAccount) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("msisdn", MaskMSISDN(c.MSISDN)),
+		slog.String("customerName", MaskName(c.CustomerName)),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (r CheckAccountResponse) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("msisdn", MaskMSISDN(r.MSISDN)),
+		slog.String("customerName", MaskName(r.CustomerName)),
+		slog.String("package", r.Package),
+		slog.String("errorCode", r.ErrorCode),
+		slog.String("errorDesc", r.ErrorDesc),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (rd RequestDisbursement) LogValue() slog.Value {
+	return slog.GroupValue(rd.logAttrs()...)
+}
+
+func (rd RequestDisbursement) logAttrs() []slog.Attr {
+	return []slog.Attr{
+		slog.String("transId", rd.TransactionID),
+		slog.String("msisdn", MaskMSISDN(rd.MSISDN)),
+		slog.String("customerName", MaskName(rd.CustomerName)),
+		slog.Uint64("amount", rd.Amount),
+	}
+}
+
+// LogValue implements slog.LogValuer.
+func (r RequestDisbursementResponse) LogValue() slog.Value {
+	return slog.GroupValue(append(r.logAttrs(),
+		slog.String("errorCode", r.ErrorCode),
+		slog.String("errorDesc", r.ErrorDesc),
+	)...)
+}
+
+// LogValue implements slog.LogValuer.
+func (r QueryRequestsResponse) LogValue() slog.Value {
+	return slog.GroupValue(append(r.logAttrs(),
+		slog.String("errorCode", r.ErrorCode),
+		slog.String("errorMsg", r.ErrorMsg),
+	)...)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *EnvelopeBase) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("orderId", e.OrderID),
+		slog.String("username", e.Username),
+		slog.String("serviceCode", e.ServiceCode),
+		slog.String("password", redacted),
+		slog.Int("data", len(e.Data)),
+	)
+}
+
+// LogValue implements slog.LogValuer.
+func (p Process) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("cmd", p.Cmd),
+		slog.Int("data", len(p.Data)),
+		slog.String("signature", redacted),
+	)
+}
+
+// String returns the command of the Process, without its data and
+// signature, which carry the encrypted password and customer data.
+func (p Process) String() string {
+	return fmt.Sprintf("{Cmd:%s Data:%s Signature:%s}", p.Cmd, redacted, redacted)
+}
+
+// GoString implements fmt.GoStringer, see String.
+func (p Process) GoString() string {
+	return "viettelpay.Process" + p.String()
+}
+
+// LogValue implements slog.LogValuer.
+func (e EnvelopeResponse) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("data", len(e.Data)),
+		slog.String("signature", redacted),
+	)
+}
+
+// logValue returns the items of a Request or result slice as a group, so
+// each item is masked by its LogValue.
+func logValue(data interface{}) slog.Value {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return slog.StringValue(redacted)
+	}
+
+	attrs := make([]slog.Attr, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i).Interface()
+		if _, ok := item.(slog.LogValuer); !ok {
+			item = redacted
+		}
+		attrs = append(attrs, slog.Any(strconv.Itoa(i), item))
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// logInterceptor logs every Process call with its outcome. The masked
+// request and response items are logged at debug level.
+func logInterceptor(logger *slog.Logger) Interceptor {
+	return func(ctx context.Context, req Request, result interface{}, invoker Invoker) (*EnvelopeResponseData, error) {
+		attrs := []slog.Attr{slog.String("cmd", req.Command())}
+		if b, ok := req.Envelope().(interface{ envelopeBase() *EnvelopeBase }); ok {
+			attrs = append(attrs, slog.String("orderId", b.envelopeBase().OrderID))
+		}
+
+		start := time.Now()
+		res, err := invoker(ctx, req, result)
+		attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+
+		if res != nil {
+			attrs = append(attrs,
+				slog.String("errorCode", res.ErrorCode),
+				slog.String("batchErrorCode", res.BatchErrorCode),
+				slog.String("requestId", res.RequestId),
+				slog.String("keyId", res.KeyID),
+			)
+		}
+
+		level, outcome := slog.LevelInfo, "success"
+		var vtpErr *Error
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			outcome = "batch_status"
+		} else if errors.As(err, &vtpErr) {
+			level, outcome = slog.LevelWarn, "rejected"
+		} else if err != nil {
+			level, outcome = slog.LevelError, "failed"
+		}
+		attrs = append(attrs, slog.String("outcome", outcome))
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+
+		logger.LogAttrs(ctx, level, "viettelpay process", attrs...)
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			logger.LogAttrs(ctx, slog.LevelDebug, "viettelpay process data",
+				slog.String("cmd", req.Command()),
+				slog.Any("request", logValue(req.Data())),
+				slog.Any("response", logValue(result)),
+			)
+		}
+
+		return res, err
+	}
+}
@@ -0,0 +1,59 @@
+package viettelpay_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMask(t *testing.T) {
+	assert.Equal(t, "84******899", viettelpay.MaskMSISDN("84365233899"))
+	assert.Equal(t, "***", viettelpay.MaskMSISDN("123"))
+	assert.Equal(t, "N*** T** Q****", viettelpay.MaskName("NGUY THI QUYNH"))
+	assert.Equal(t, "Đ*** T** Q****", viettelpay.MaskName("Đinh Thị Quỳnh"))
+}
+
+func TestWithLogger(t *testing.T) {
+	srv, err := emulator.NewServer(emulator.WithCredentials("partner", "s3cr3t-password", "SC"))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	buf := bytes.NewBuffer(nil)
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	api, err := srv.PartnerAPI(viettelpay.WithLogger(logger))
+	require.NoError(t, err)
+
+	orderID := viettelpay.GenOrderID()
+	_, err = api.CheckAccount(context.Background(), orderID,
+		viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Nguyen Van Anh"})
+	require.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, `"cmd":"VTP305"`)
+	assert.Contains(t, out, `"orderId":"`+orderID+`"`)
+	assert.Contains(t, out, `"outcome":"success"`)
+	assert.Contains(t, out, `"duration":`)
+	assert.Contains(t, out, "84******899")
+	assert.Contains(t, out, "N***** V** A**")
+	assert.NotContains(t, out, "84365233899")
+	assert.NotContains(t, out, "Nguyen")
+	assert.NotContains(t, out, "s3cr3t-password")
+}
+
+func TestProcess_String(t *testing.T) {
+	p := viettelpay.Process{Cmd: "VTP305", Data: `{"password":"encrypted"}`, Signature: "c2lnbmF0dXJl"}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		out := fmt.Sprintf(format, p)
+		assert.Contains(t, out, "VTP305", format)
+		assert.NotContains(t, out, "encrypted", format)
+		assert.NotContains(t, out, "c2lnbmF0dXJl", format)
+	}
+}
@@ -0,0 +1,138 @@
+package viettelpay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sethvargo/go-envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrProfileNotFound is returned when a config file has no profile of the
+// requested name.
+var ErrProfileNotFound = errors.New("viettelpay: profile not found")
+
+// ConfigFile is a config file holding named profiles, such as "sandbox"
+// and "production". Its keys are the lower case names of the VIETTELPAY_*
+// environment variables:
+//
+//	profiles:
+//	  sandbox:
+//	    base_url: https://sandbox.example.com/PartnerWS
+//	    username: partner
+//	    service_code: PARTNER
+//	    password: file:///run/secrets/password?decoder=string
+//	    partner_private_key: file:///run/secrets/partner.pem?decoder=string
+//	    viettel_public_key: file:///etc/viettelpay/viettel.pem?decoder=string
+//
+// The secrets, the password and the keys, are runtimevar URLs like in the
+// environment, the other values are plain strings.
+type ConfigFile struct {
+	Profiles map[string]map[string]string `yaml:"profiles" toml:"profiles"`
+}
+
+// configFileReferences are the keys whose values are runtimevar URLs in a
+// ConfigFile.
+var configFileReferences = map[string]bool{
+	"PASSWORD":                    true,
+	"PARTNER_PRIVATE_KEY":         true,
+	"VIETTEL_PUBLIC_KEY":          true,
+	"VIETTEL_PREVIOUS_PUBLIC_KEY": true,
+}
+
+// ReadConfigFile reads a YAML or TOML config file, depending on its
+// extension.
+func ReadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f ConfigFile
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &f)
+	case ".toml":
+		err = toml.Unmarshal(data, &f)
+	default:
+		return nil, fmt.Errorf("viettelpay: unsupported config file extension %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("viettelpay: %s: %w", path, err)
+	}
+
+	return &f, nil
+}
+
+// DefaultConfigFile returns the path of the config file: the
+// VIETTELPAY_CONFIG_FILE environment variable if set, else the first of
+// config.yaml, config.yml or config.toml found in the viettelpay directory
+// of os.UserConfigDir.
+func DefaultConfigFile() (string, error) {
+	if path := os.Getenv("VIETTELPAY_CONFIG_FILE"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{"config.yaml", "config.yml", "config.toml"} {
+		path := filepath.Join(dir, "viettelpay", name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("viettelpay: no config file in %s", filepath.Join(dir, "viettelpay"))
+}
+
+// ProvideConfigProfile is like ProvideConfig, but reads the values missing
+// from the environment from the profile name of the DefaultConfigFile.
+func ProvideConfigProfile(ctx context.Context, name string) (*Config, error) {
+	path, err := DefaultConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return ProvideConfigFile(ctx, path, name)
+}
+
+// ProvideConfigFile is like ProvideConfigProfile, with the config file at
+// path.
+func ProvideConfigFile(ctx context.Context, path, name string) (*Config, error) {
+	f, err := ReadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q in %s", ErrProfileNotFound, name, path)
+	}
+
+	return processProfile(ctx, profile, "VIETTELPAY_")
+}
+
+// processProfile reads the Config from the environment variables starting
+// with envPrefix, then from profile.
+func processProfile(ctx context.Context, profile map[string]string, envPrefix string) (*Config, error) {
+	values := make(map[string]string, len(profile))
+	for k, v := range profile {
+		values[strings.ToUpper(k)] = v
+	}
+
+	env := envconfig.PrefixLookuper(envPrefix, envconfig.OsLookuper())
+	l := envconfig.MultiLookuper(env, envconfig.MapLookuper(values))
+
+	return processConfigWith(ctx, l, func(ctx context.Context, key, value string) (string, error) {
+		if _, fromEnv := env.Lookup(key); !fromEnv && !configFileReferences[key] {
+			return value, nil
+		}
+		return resolveSecretFunc(ctx, key, value)
+	})
+}
@@ -0,0 +1,94 @@
+package viettelpay_test
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "gocloud.dev/runtimevar/filevar"
+)
+
+func TestProvideConfigFile(t *testing.T) {
+	keys, err := emulator.GenerateKeys(1024)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+	partnerKey := writeFile("partner.pem", string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: keys.PartnerPrivateKey})))
+	viettelKey := writeFile("viettel.pem", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: keys.ViettelPublicKey})))
+	password := writeFile("password", "secret")
+	ref := func(path string) string {
+		return "file://" + filepath.ToSlash(path) + "?decoder=string"
+	}
+
+	yamlFile := writeFile("config.yaml", `
+profiles:
+  sandbox:
+    base_url: https://sandbox.example.com/PartnerWS
+    username: sandbox
+    service_code: SANDBOX
+    password: `+ref(password)+`
+    partner_private_key: `+ref(partnerKey)+`
+    viettel_public_key: `+ref(viettelKey)+`
+  production:
+    base_url: https://example.com/PartnerWS
+    username: production
+`)
+	tomlFile := writeFile("config.toml", `
+[profiles.sandbox]
+base_url = "https://sandbox.example.com/PartnerWS"
+username = "sandbox"
+service_code = "SANDBOX"
+password = "`+ref(password)+`"
+partner_private_key = "`+ref(partnerKey)+`"
+viettel_public_key = "`+ref(viettelKey)+`"
+`)
+
+	ctx := context.Background()
+	for _, path := range []string{yamlFile, tomlFile} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			cfg, err := viettelpay.ProvideConfigFile(ctx, path, "sandbox")
+			require.NoError(t, err)
+			assert.Equal(t, "https://sandbox.example.com/PartnerWS", cfg.BaseURL)
+			assert.Equal(t, "sandbox", cfg.Username)
+			assert.Equal(t, "SANDBOX", cfg.ServiceCode)
+			assert.Equal(t, "secret", cfg.Password)
+			assert.Equal(t, keys.PartnerPrivateKey, cfg.PartnerPrivateKey.Bytes())
+			assert.Equal(t, keys.ViettelPublicKey, cfg.ViettelPublicKey.Bytes())
+		})
+	}
+
+	t.Run("env overrides", func(t *testing.T) {
+		t.Setenv("VIETTELPAY_USERNAME", constantVar("override"))
+		t.Setenv("VIETTELPAY_CONFIG_FILE", yamlFile)
+
+		cfg, err := viettelpay.ProvideConfigProfile(ctx, "sandbox")
+		require.NoError(t, err)
+		assert.Equal(t, "override", cfg.Username)
+		assert.Equal(t, "SANDBOX", cfg.ServiceCode)
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		_, err := viettelpay.ProvideConfigFile(ctx, yamlFile, "staging")
+		assert.True(t, errors.Is(err, viettelpay.ErrProfileNotFound))
+	})
+
+	t.Run("missing keys", func(t *testing.T) {
+		cfg, err := viettelpay.ProvideConfigFile(ctx, yamlFile, "production")
+		require.NoError(t, err)
+		_, err = viettelpay.ProvidePartnerAPI(cfg, nil)
+		assert.Error(t, err)
+	})
+}
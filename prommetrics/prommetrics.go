@@ -0,0 +1,194 @@
+// Package prommetrics collects Prometheus metrics of partner API calls.
+//
+// Register a Collector and add its interceptor to the PartnerAPI:
+//
+//	m := prommetrics.New()
+//	prometheus.MustRegister(m)
+//	api, err := viettelpay.NewPartnerAPI(url, viettelpay.WithInterceptors(m.Interceptor()), ...)
+package prommetrics
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"time"
+
+	"giautm.dev/viettelpay"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector of partner API metrics.
+type Collector struct {
+	duration          *prometheus.HistogramVec
+	errorCodes        *prometheus.CounterVec
+	batchErrorCodes   *prometheus.CounterVec
+	signatureFailures prometheus.Counter
+	acceptedAmount    prometheus.Counter
+	submittedAmount   *prometheus.CounterVec
+	batchTransactions prometheus.Histogram
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+type options struct {
+	namespace   string
+	constLabels prometheus.Labels
+	buckets     []float64
+}
+
+// A Option sets options such as namespace, labels, etc.
+type Option func(*options)
+
+// WithNamespace is an Option to set the metric namespace. Default is
+// "viettelpay".
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithConstLabels is an Option to add labels to every metric, such as the
+// merchant the PartnerAPI belongs to.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(o *options) {
+		o.constLabels = labels
+	}
+}
+
+// WithBuckets is an Option to set the buckets of the latency histogram.
+func WithBuckets(buckets []float64) Option {
+	return func(o *options) {
+		o.buckets = buckets
+	}
+}
+
+// New creates a Collector.
+func New(opt ...Option) *Collector {
+	opts := options{
+		namespace: "viettelpay",
+		buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	return &Collector{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.namespace,
+			Name:        "request_duration_seconds",
+			Help:        "Latency of partner API calls, by command.",
+			ConstLabels: opts.constLabels,
+			Buckets:     opts.buckets,
+		}, []string{"command"}),
+		errorCodes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.namespace,
+			Name:        "responses_total",
+			Help:        "Partner API responses, by command and errorCode, other when it is not in the catalog.",
+			ConstLabels: opts.constLabels,
+		}, []string{"command", "error_code"}),
+		batchErrorCodes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.namespace,
+			Name:        "batch_responses_total",
+			Help:        "Partner API responses carrying a batchErrorCode, by command and batchErrorCode, other when it is not in the catalog.",
+			ConstLabels: opts.constLabels,
+		}, []string{"command", "batch_error_code"}),
+		signatureFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   opts.namespace,
+			Name:        "signature_failures_total",
+			Help:        "Responses whose Viettel signature could not be verified.",
+			ConstLabels: opts.constLabels,
+		}),
+		acceptedAmount: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   opts.namespace,
+			Name:        "accepted_amount_vnd_total",
+			Help:        "Total amount in VND of RequestDisbursement lines accepted by Viettel, not yet disbursed.",
+			ConstLabels: opts.constLabels,
+		}),
+		submittedAmount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.namespace,
+			Name:        "submitted_amount_vnd_total",
+			Help:        "Total amount in VND of RequestDisbursement batches, by errorCode, other when it is not in the catalog, empty when Viettel did not answer.",
+			ConstLabels: opts.constLabels,
+		}, []string{"error_code"}),
+		batchTransactions: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   opts.namespace,
+			Name:        "batch_transactions",
+			Help:        "Number of transactions of RequestDisbursement batches accepted by Viettel.",
+			ConstLabels: opts.constLabels,
+			Buckets:     prometheus.ExponentialBuckets(1, 4, 7),
+		}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.duration.Describe(ch)
+	c.errorCodes.Describe(ch)
+	c.batchErrorCodes.Describe(ch)
+	c.signatureFailures.Describe(ch)
+	c.acceptedAmount.Describe(ch)
+	c.submittedAmount.Describe(ch)
+	c.batchTransactions.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.duration.Collect(ch)
+	c.errorCodes.Collect(ch)
+	c.batchErrorCodes.Collect(ch)
+	c.signatureFailures.Collect(ch)
+	c.acceptedAmount.Collect(ch)
+	c.submittedAmount.Collect(ch)
+	c.batchTransactions.Collect(ch)
+}
+
+// Interceptor returns the viettelpay.Interceptor recording the metrics.
+func (c *Collector) Interceptor() viettelpay.Interceptor {
+	return func(ctx context.Context, req viettelpay.Request, result interface{}, invoker viettelpay.Invoker) (*viettelpay.EnvelopeResponseData, error) {
+		cmd := req.Command()
+
+		start := time.Now()
+		res, err := invoker(ctx, req, result)
+		c.duration.WithLabelValues(cmd).Observe(time.Since(start).Seconds())
+
+		if errors.Is(err, rsa.ErrVerification) {
+			c.signatureFailures.Inc()
+		}
+		env, isDisbursement := req.Envelope().(*viettelpay.RequestDisbursementEnvelope)
+		if res == nil {
+			if isDisbursement {
+				c.submittedAmount.WithLabelValues("").Add(float64(env.TotalAmount))
+			}
+			return res, err
+		}
+
+		c.errorCodes.WithLabelValues(cmd, codeLabel(res.ErrorCode)).Inc()
+		if res.BatchErrorCode != "" {
+			c.batchErrorCodes.WithLabelValues(cmd, codeLabel(res.BatchErrorCode)).Inc()
+		}
+		if isDisbursement {
+			c.submittedAmount.WithLabelValues(codeLabel(res.ErrorCode)).Add(float64(env.TotalAmount))
+			if res.ErrorCode == viettelpay.CodeSuccess {
+				c.batchTransactions.Observe(float64(env.TotalTransactions))
+			}
+			if lines, ok := result.(*[]viettelpay.RequestDisbursementResponse); ok && err == nil {
+				for _, l := range *lines {
+					if l.ErrorCode == viettelpay.CodeSuccess {
+						c.acceptedAmount.Add(float64(l.Amount))
+					}
+				}
+			}
+		}
+
+		return res, err
+	}
+}
+
+// codeLabel returns the label of a code, "other" when it is not in the
+// catalog, so that the cardinality of the labels is bounded.
+func codeLabel(code string) string {
+	if _, ok := viettelpay.LookupCode(code); !ok {
+		return "other"
+	}
+	return code
+}
@@ -0,0 +1,83 @@
+package prommetrics_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"giautm.dev/viettelpay/prommetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	srv, err := emulator.NewServer(
+		emulator.WithPendingQueries(0),
+		emulator.WithAccounts(emulator.Account{MSISDN: "84365233899", CustomerName: "A"}),
+	)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	m := prommetrics.New()
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(m))
+
+	api, err := srv.PartnerAPI(viettelpay.WithInterceptors(m.Interceptor()))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	orderID := viettelpay.GenOrderID()
+	_, err = api.RequestDisbursement(ctx, orderID, "Test",
+		viettelpay.RequestDisbursement{TransactionID: "T1", MSISDN: "84365233899", CustomerName: "A", Amount: 1000},
+		viettelpay.RequestDisbursement{TransactionID: "T2", MSISDN: "84365233898", CustomerName: "B", Amount: 2500},
+	)
+	require.NoError(t, err)
+	_, err = api.RequestDisbursement(ctx, orderID, "Test",
+		viettelpay.RequestDisbursement{TransactionID: "T3", MSISDN: "84365233899", CustomerName: "A", Amount: 500},
+	)
+	require.Error(t, err)
+	_, _, _ = api.QueryRequests(ctx, orderID, nil)
+	_, _, _ = api.QueryRequests(ctx, "MISSING", nil)
+
+	// A key store trusting the wrong key fails to verify every response.
+	keyStore, err := viettelpay.NewKeyStore(srv.Keys.PartnerPrivateKey, srv.Keys.PartnerPublicKey)
+	require.NoError(t, err)
+	bad, err := srv.PartnerAPI(viettelpay.WithKeyStore(keyStore), viettelpay.WithInterceptors(m.Interceptor()))
+	require.NoError(t, err)
+	_, _, err = bad.QueryRequests(ctx, orderID, nil)
+	require.Error(t, err)
+
+	err = testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP viettelpay_accepted_amount_vnd_total Total amount in VND of RequestDisbursement lines accepted by Viettel, not yet disbursed.
+# TYPE viettelpay_accepted_amount_vnd_total counter
+viettelpay_accepted_amount_vnd_total 1000
+# HELP viettelpay_batch_responses_total Partner API responses carrying a batchErrorCode, by command and batchErrorCode, other when it is not in the catalog.
+# TYPE viettelpay_batch_responses_total counter
+viettelpay_batch_responses_total{batch_error_code="DISB_SUCCESS",command="VTP307"} 1
+# HELP viettelpay_responses_total Partner API responses, by command and errorCode, other when it is not in the catalog.
+# TYPE viettelpay_responses_total counter
+viettelpay_responses_total{command="VTP306",error_code="00"} 1
+viettelpay_responses_total{command="VTP306",error_code="other"} 1
+viettelpay_responses_total{command="VTP307",error_code="00"} 1
+viettelpay_responses_total{command="VTP307",error_code="other"} 1
+# HELP viettelpay_signature_failures_total Responses whose Viettel signature could not be verified.
+# TYPE viettelpay_signature_failures_total counter
+viettelpay_signature_failures_total 1
+# HELP viettelpay_submitted_amount_vnd_total Total amount in VND of RequestDisbursement batches, by errorCode, other when it is not in the catalog, empty when Viettel did not answer.
+# TYPE viettelpay_submitted_amount_vnd_total counter
+viettelpay_submitted_amount_vnd_total{error_code="00"} 3500
+viettelpay_submitted_amount_vnd_total{error_code="other"} 500
+`),
+		"viettelpay_accepted_amount_vnd_total",
+		"viettelpay_batch_responses_total",
+		"viettelpay_responses_total",
+		"viettelpay_signature_failures_total",
+		"viettelpay_submitted_amount_vnd_total",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, testutil.CollectAndCount(m, "viettelpay_request_duration_seconds"))
+}
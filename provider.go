@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/sethvargo/go-envconfig"
 	"gocloud.dev/runtimevar"
@@ -15,9 +18,17 @@ var ErrNoPEM = errors.New("no PEM data is found")
 // environment variable.
 type BlockPEM []byte
 
-// EnvDecode implements env.Decoder.
+// EnvDecode implements env.Decoder. The type of the block is dropped, so an
+// encrypted private key is rejected with ErrEncryptedKey rather than left to
+// fail as an unknown key format.
 func (b *BlockPEM) EnvDecode(val string) error {
+	if val == "" {
+		return nil
+	}
 	if block, _ := pem.Decode(([]byte)(val)); block != nil {
+		if block.Type == EncryptedPrivateKeyPEMType || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+			return ErrEncryptedKey
+		}
 		*b = block.Bytes
 		return nil
 	}
@@ -37,41 +48,118 @@ type Config struct {
 	ServiceCode string `env:"SERVICE_CODE"`
 
 	PartnerPrivateKey BlockPEM `env:"PARTNER_PRIVATE_KEY"`
-	ViettelPublicKey  BlockPEM `env:"VIETTEL_PUBLIC_KEY"`
+	// PartnerPrivateKeyKeeper is the URL of a gocloud secrets keeper. When
+	// set, PartnerPrivateKey is encrypted by that keeper, see
+	// EncryptPrivateKey, and ProvideConfig decrypts it.
+	PartnerPrivateKeyKeeper string   `env:"PARTNER_PRIVATE_KEY_KEEPER"`
+	ViettelPublicKey        BlockPEM `env:"VIETTEL_PUBLIC_KEY"`
+	// ViettelPublicKeyNotAfter is the time, in RFC 3339, after which
+	// ViettelPublicKey is no longer trusted to verify responses.
+	ViettelPublicKeyNotAfter string `env:"VIETTEL_PUBLIC_KEY_NOT_AFTER"`
+	// ViettelPreviousPublicKey is also trusted to verify responses during a
+	// key rotation.
+	ViettelPreviousPublicKey BlockPEM `env:"VIETTEL_PREVIOUS_PUBLIC_KEY"`
+
+	// SignScheme and VerifyScheme select the signature schemes, such as
+	// "SHA256WithRSA". Default is SHA1WithRSA.
+	SignScheme   SignatureScheme `env:"SIGN_SCHEME"`
+	VerifyScheme SignatureScheme `env:"VERIFY_SCHEME"`
+}
+
+// keyStoreOptions returns the KeyStoreOptions set by the config.
+func (c *Config) keyStoreOptions() ([]KeyStoreOption, error) {
+	var opts []KeyStoreOption
+	if len(c.ViettelPreviousPublicKey) > 0 {
+		key, err := ParsePublicKey(c.ViettelPreviousPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTrustedKeys(TrustedKey{Key: key}))
+	}
+	if c.ViettelPublicKeyNotAfter != "" {
+		notAfter, err := time.Parse(time.RFC3339, c.ViettelPublicKeyNotAfter)
+		if err != nil {
+			return nil, fmt.Errorf("viettelpay: VIETTEL_PUBLIC_KEY_NOT_AFTER: %w", err)
+		}
+		opts = append(opts, WithViettelKeyNotAfter(notAfter))
+	}
+	if c.SignScheme.Hash != 0 {
+		opts = append(opts, WithSignScheme(c.SignScheme))
+	}
+	if c.VerifyScheme.Hash != 0 {
+		opts = append(opts, WithVerifyScheme(c.VerifyScheme))
+	}
+	return opts, nil
 }
 
 func ProvideConfig(ctx context.Context) (*Config, error) {
-	var config Config
+	return processConfig(ctx, resolveSecretFunc)
+}
 
+// processConfig reads the Config from the environment, resolving each
+// value with resolve.
+func processConfig(ctx context.Context, resolve envconfig.MutatorFunc) (*Config, error) {
 	l := envconfig.PrefixLookuper("VIETTELPAY_", envconfig.OsLookuper())
-	err := envconfig.ProcessWith(ctx, &config, l, resolveSecretFunc)
+	return processConfigWith(ctx, l, resolve)
+}
+
+// processConfigWith reads the Config from l, resolving each value with
+// resolve.
+func processConfigWith(ctx context.Context, l envconfig.Lookuper, resolve envconfig.MutatorFunc) (*Config, error) {
+	var config Config
+
+	err := envconfig.ProcessWith(ctx, &config, l, resolve)
 	if err != nil {
 		return nil, err
 	}
 
+	if config.PartnerPrivateKeyKeeper != "" {
+		config.PartnerPrivateKey, err = DecryptPrivateKey(ctx, config.PartnerPrivateKeyKeeper, config.PartnerPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &config, nil
 }
 
-func ProvidePartnerAPI(cfg *Config, client HTTPClient) (PartnerAPI, error) {
-	keyStore, err := NewKeyStore(cfg.PartnerPrivateKey, cfg.ViettelPublicKey)
+func ProvidePartnerAPI(cfg *Config, client HTTPClient, opt ...Option) (PartnerAPI, error) {
+	keyStoreOpts, err := cfg.keyStoreOptions()
+	if err != nil {
+		return nil, err
+	}
+	keyStore, err := NewKeyStore(cfg.PartnerPrivateKey, cfg.ViettelPublicKey, keyStoreOpts...)
 	if err != nil {
 		return nil, err
 	}
 
 	return NewPartnerAPI(
 		cfg.BaseURL,
-		WithAuth(cfg.Username, cfg.Password, cfg.ServiceCode),
-		WithHTTPClient(client),
-		WithKeyStore(keyStore),
+		append([]Option{
+			WithAuth(cfg.Username, cfg.Password, cfg.ServiceCode),
+			WithHTTPClient(client),
+			WithKeyStore(keyStore),
+		}, opt...)...,
 	)
 }
 
 func resolveSecretFunc(ctx context.Context, key, value string) (string, error) {
+	// Optional variables are left unset.
+	if value == "" {
+		return "", nil
+	}
+
 	v, err := runtimevar.OpenVariable(ctx, value)
 	if err != nil {
 		return "", err
 	}
 
+	return latestValue(ctx, v, value)
+}
+
+// latestValue returns the latest value of v as a string, or value when v
+// is neither a string nor bytes.
+func latestValue(ctx context.Context, v *runtimevar.Variable, value string) (string, error) {
 	snap, err := v.Latest(ctx)
 	if err != nil {
 		return "", err
@@ -0,0 +1,65 @@
+package viettelpay_test
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "gocloud.dev/runtimevar/constantvar"
+)
+
+// constantVar returns a runtimevar URL holding val.
+func constantVar(val string) string {
+	return "constant://?decoder=string&val=" + url.QueryEscape(val)
+}
+
+func TestProvideConfigOptional(t *testing.T) {
+	keys, err := emulator.GenerateKeys(1024)
+	require.NoError(t, err)
+
+	t.Setenv("VIETTELPAY_BASE_URL", constantVar("http://localhost"))
+	t.Setenv("VIETTELPAY_PARTNER_PRIVATE_KEY", constantVar(string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: keys.PartnerPrivateKey}))))
+	t.Setenv("VIETTELPAY_VIETTEL_PUBLIC_KEY", constantVar(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: keys.ViettelPublicKey}))))
+
+	cfg, err := viettelpay.ProvideConfig(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, keys.PartnerPrivateKey, cfg.PartnerPrivateKey.Bytes())
+	assert.Equal(t, viettelpay.SignatureScheme{}, cfg.SignScheme)
+	assert.Empty(t, cfg.ViettelPreviousPublicKey)
+
+	_, err = viettelpay.ProvidePartnerAPI(cfg, nil)
+	assert.NoError(t, err)
+
+	t.Setenv("VIETTELPAY_VIETTEL_PUBLIC_KEY_NOT_AFTER", constantVar("2030-01-01T00:00:00Z"))
+	cfg, err = viettelpay.ProvideConfig(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "2030-01-01T00:00:00Z", cfg.ViettelPublicKeyNotAfter)
+	_, err = viettelpay.ProvidePartnerAPI(cfg, nil)
+	assert.NoError(t, err)
+
+	cfg.ViettelPublicKeyNotAfter = "2030-01-01"
+	_, err = viettelpay.ProvidePartnerAPI(cfg, nil)
+	assert.Error(t, err)
+}
+
+func TestBlockPEMEncryptedKey(t *testing.T) {
+	for _, val := range []string{
+		string(pem.EncodeToMemory(&pem.Block{Type: viettelpay.EncryptedPrivateKeyPEMType, Bytes: []byte("secret")})),
+		string(pem.EncodeToMemory(&pem.Block{
+			Type:    viettelpay.RSAPrivateKeyPEMType,
+			Headers: map[string]string{"Proc-Type": "4,ENCRYPTED", "DEK-Info": "AES-256-CBC,00000000000000000000000000000000"},
+			Bytes:   []byte("secret"),
+		})),
+	} {
+		var b viettelpay.BlockPEM
+		assert.True(t, errors.Is(b.EnvDecode(val), viettelpay.ErrEncryptedKey))
+		assert.Empty(t, b)
+	}
+}
@@ -0,0 +1,153 @@
+package viettelpay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// ErrMerchantNotFound is returned by a Registry for an unknown merchant.
+var ErrMerchantNotFound = errors.New("viettelpay: merchant not found")
+
+// Registry holds the PartnerAPIs of several merchants, each with its own
+// credentials and keys, sharing one HTTP client.
+type Registry struct {
+	client HTTPClient
+	opt    []Option
+
+	mu      sync.RWMutex
+	apis    map[string]PartnerAPI
+	configs map[string]*Config
+}
+
+// NewRegistry creates an empty Registry. The PartnerAPIs use client, or a
+// shared http.Client if nil, and the options, such as WithLogger or
+// WithRetryPolicy.
+func NewRegistry(client HTTPClient, opt ...Option) *Registry {
+	if client == nil {
+		client = &http.Client{Timeout: 90 * time.Second}
+	}
+
+	return &Registry{
+		client:  client,
+		opt:     opt,
+		apis:    map[string]PartnerAPI{},
+		configs: map[string]*Config{},
+	}
+}
+
+// Add creates the PartnerAPI of a merchant, replacing any previous one. The
+// options are applied after the options of the Registry.
+func (r *Registry) Add(merchantID string, cfg *Config, opt ...Option) error {
+	api, err := ProvidePartnerAPI(cfg, r.client, append(append([]Option{}, r.opt...), opt...)...)
+	if err != nil {
+		return fmt.Errorf("viettelpay: merchant %q: %w", merchantID, err)
+	}
+
+	r.mu.Lock()
+	r.apis[merchantID] = api
+	r.configs[merchantID] = cfg
+	r.mu.Unlock()
+
+	return nil
+}
+
+// Get returns the PartnerAPI of a merchant.
+func (r *Registry) Get(merchantID string) (PartnerAPI, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	api, ok := r.apis[merchantID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrMerchantNotFound, merchantID)
+	}
+	return api, nil
+}
+
+// Config returns the Config of a merchant.
+func (r *Registry) Config(merchantID string) (*Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cfg, ok := r.configs[merchantID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrMerchantNotFound, merchantID)
+	}
+	return cfg, nil
+}
+
+// Merchants returns the sorted IDs of the merchants.
+func (r *Registry) Merchants() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.apis))
+	for id := range r.apis {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// MerchantEnvPrefix returns the prefix of the environment variables of a
+// merchant, such as VIETTELPAY_MERCHANT_BU_NORTH_ for "bu-north". The
+// MERCHANT_ part keeps them apart from the variables of ProvideConfig, such
+// as VIETTELPAY_PARTNER_PRIVATE_KEY, for a merchant named "partner".
+func MerchantEnvPrefix(merchantID string) string {
+	return "VIETTELPAY_MERCHANT_" + strings.ToUpper(strings.ReplaceAll(merchantID, "-", "_")) + "_"
+}
+
+// ProvideMerchantConfig is like ProvideConfig, with the environment
+// variables of a merchant, see MerchantEnvPrefix.
+func ProvideMerchantConfig(ctx context.Context, merchantID string) (*Config, error) {
+	l := envconfig.PrefixLookuper(MerchantEnvPrefix(merchantID), envconfig.OsLookuper())
+	return processConfigWith(ctx, l, resolveSecretFunc)
+}
+
+// ProvideRegistry creates a Registry of the merchants configured by the
+// environment, see ProvideMerchantConfig.
+func ProvideRegistry(ctx context.Context, client HTTPClient, merchantIDs []string, opt ...Option) (*Registry, error) {
+	r := NewRegistry(client, opt...)
+	for _, id := range merchantIDs {
+		cfg, err := ProvideMerchantConfig(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("viettelpay: merchant %q: %w", id, err)
+		}
+		if err = r.Add(id, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// ProvideRegistryFile creates a Registry with a merchant for each profile of
+// the config file at path, see ProvideConfigFile. The environment variables
+// of a merchant, see MerchantEnvPrefix, override the values of its profile.
+func ProvideRegistryFile(ctx context.Context, path string, client HTTPClient, opt ...Option) (*Registry, error) {
+	f, err := ReadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewRegistry(client, opt...)
+	for id, profile := range f.Profiles {
+		cfg, err := processProfile(ctx, profile, MerchantEnvPrefix(id))
+		if err != nil {
+			return nil, fmt.Errorf("viettelpay: merchant %q: %w", id, err)
+		}
+		if err = r.Add(id, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,71 @@
+package viettelpay_test
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingClient struct {
+	client viettelpay.HTTPClient
+	calls  int32
+}
+
+func (c *countingClient) Do(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return c.client.Do(req)
+}
+
+func TestRegistry(t *testing.T) {
+	north, err := emulator.NewServer(emulator.WithCredentials("north", "north-secret", "NORTH"))
+	require.NoError(t, err)
+	defer north.Close()
+	south, err := emulator.NewServer(emulator.WithCredentials("south", "south-secret", "SOUTH"))
+	require.NoError(t, err)
+	defer south.Close()
+
+	setEnv := func(merchantID string, srv *emulator.Server, username, password, serviceCode string) {
+		prefix := viettelpay.MerchantEnvPrefix(merchantID)
+		t.Setenv(prefix+"BASE_URL", constantVar(srv.URL))
+		t.Setenv(prefix+"USERNAME", constantVar(username))
+		t.Setenv(prefix+"PASSWORD", constantVar(password))
+		t.Setenv(prefix+"SERVICE_CODE", constantVar(serviceCode))
+		t.Setenv(prefix+"PARTNER_PRIVATE_KEY", constantVar(string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: srv.Keys.PartnerPrivateKey}))))
+		t.Setenv(prefix+"VIETTEL_PUBLIC_KEY", constantVar(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: srv.Keys.ViettelPublicKey}))))
+	}
+	setEnv("bu-north", north, "north", "north-secret", "NORTH")
+	setEnv("bu-south", south, "south", "south-secret", "SOUTH")
+	assert.Equal(t, "VIETTELPAY_MERCHANT_BU_NORTH_", viettelpay.MerchantEnvPrefix("bu-north"))
+	assert.Equal(t, "VIETTELPAY_MERCHANT_PARTNER_", viettelpay.MerchantEnvPrefix("partner"))
+
+	ctx := context.Background()
+	client := &countingClient{client: http.DefaultClient}
+	registry, err := viettelpay.ProvideRegistry(ctx, client, []string{"bu-north", "bu-south"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bu-north", "bu-south"}, registry.Merchants())
+
+	check := viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Nguyen Van A"}
+	for _, id := range registry.Merchants() {
+		api, err := registry.Get(id)
+		require.NoError(t, err)
+
+		_, err = api.CheckAccount(ctx, viettelpay.GenOrderID(), check)
+		assert.NoError(t, err, id)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&client.calls))
+
+	cfg, err := registry.Config("bu-south")
+	require.NoError(t, err)
+	assert.Equal(t, "SOUTH", cfg.ServiceCode)
+
+	_, err = registry.Get("bu-east")
+	assert.True(t, errors.Is(err, viettelpay.ErrMerchantNotFound))
+}
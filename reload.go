@@ -0,0 +1,204 @@
+package viettelpay
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"gocloud.dev/runtimevar"
+)
+
+// ReloadingPartnerAPI is a PartnerAPI built from the environment like
+// ProvideConfig and ProvidePartnerAPI, which is rebuilt whenever one of the
+// runtimevar variables behind the Config changes. Calls in flight during a
+// reload complete with the previous credentials and keys.
+//
+// A reload which fails, such as with a malformed key, keeps the previous
+// PartnerAPI and is logged to the logger set by WithLogger.
+type ReloadingPartnerAPI struct {
+	client HTTPClient
+	opt    []Option
+	logger *slog.Logger
+
+	current atomic.Value // *reloadState
+
+	mu   sync.Mutex
+	vars map[string]*runtimevar.Variable
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ PartnerAPI = (*ReloadingPartnerAPI)(nil)
+
+type reloadState struct {
+	cfg *Config
+	api PartnerAPI
+}
+
+// ProvideReloadingPartnerAPI creates a ReloadingPartnerAPI. The options are
+// applied to every rebuilt PartnerAPI. Close must be called to stop
+// watching the variables.
+func ProvideReloadingPartnerAPI(ctx context.Context, client HTTPClient, opt ...Option) (*ReloadingPartnerAPI, error) {
+	var opts options
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	r := &ReloadingPartnerAPI{
+		client: client,
+		opt:    opt,
+		logger: opts.logger,
+		vars:   map[string]*runtimevar.Variable{},
+	}
+	if _, err := r.reload(ctx); err != nil {
+		r.closeVars()
+		return nil, err
+	}
+
+	watchCtx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	changed := make(chan struct{}, 1)
+	for _, v := range r.vars {
+		r.wg.Add(1)
+		go r.watch(watchCtx, v, changed)
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for {
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-changed:
+			}
+
+			reloaded, err := r.reload(watchCtx)
+			if err != nil && watchCtx.Err() == nil {
+				r.log(watchCtx, slog.LevelError, "viettelpay reload failed", slog.String("error", err.Error()))
+			} else if reloaded {
+				r.log(watchCtx, slog.LevelInfo, "viettelpay reloaded")
+			}
+		}
+	}()
+
+	return r, nil
+}
+
+// Config returns the Config of the current PartnerAPI.
+func (r *ReloadingPartnerAPI) Config() *Config {
+	return r.state().cfg
+}
+
+// Close stops watching the variables and closes them.
+func (r *ReloadingPartnerAPI) Close() error {
+	r.cancel()
+	r.wg.Wait()
+
+	return r.closeVars()
+}
+
+func (r *ReloadingPartnerAPI) Process(ctx context.Context, req Request, response interface{}) error {
+	return r.state().api.Process(ctx, req, response)
+}
+
+func (r *ReloadingPartnerAPI) CheckAccount(ctx context.Context, orderID string, checks ...CheckAccount) ([]CheckAccountResponse, error) {
+	return r.state().api.CheckAccount(ctx, orderID, checks...)
+}
+
+func (r *ReloadingPartnerAPI) RequestDisbursement(ctx context.Context, orderID string, transactionContent string, reqs ...RequestDisbursement) ([]RequestDisbursementResponse, error) {
+	return r.state().api.RequestDisbursement(ctx, orderID, transactionContent, reqs...)
+}
+
+func (r *ReloadingPartnerAPI) QueryRequests(ctx context.Context, orderID string, query QueryRequests) ([]QueryRequestsResponse, BatchStatus, error) {
+	return r.state().api.QueryRequests(ctx, orderID, query)
+}
+
+func (r *ReloadingPartnerAPI) state() *reloadState {
+	return r.current.Load().(*reloadState)
+}
+
+// reload rebuilds the PartnerAPI from the latest values of the variables.
+// It reports false when the Config is unchanged.
+func (r *ReloadingPartnerAPI) reload(ctx context.Context) (bool, error) {
+	cfg, err := processConfig(ctx, r.resolve)
+	if err != nil {
+		return false, err
+	}
+	if s, ok := r.current.Load().(*reloadState); ok && reflect.DeepEqual(s.cfg, cfg) {
+		return false, nil
+	}
+
+	api, err := ProvidePartnerAPI(cfg, r.client, r.opt...)
+	if err != nil {
+		return false, err
+	}
+
+	r.current.Store(&reloadState{cfg: cfg, api: api})
+	return true, nil
+}
+
+// resolve is like resolveSecretFunc, but keeps the variables open to watch
+// them.
+func (r *ReloadingPartnerAPI) resolve(ctx context.Context, key, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	r.mu.Lock()
+	v, ok := r.vars[value]
+	if !ok {
+		var err error
+		if v, err = runtimevar.OpenVariable(ctx, value); err != nil {
+			r.mu.Unlock()
+			return "", err
+		}
+		r.vars[value] = v
+	}
+	r.mu.Unlock()
+
+	return latestValue(ctx, v, value)
+}
+
+func (r *ReloadingPartnerAPI) watch(ctx context.Context, v *runtimevar.Variable, changed chan<- struct{}) {
+	defer r.wg.Done()
+
+	for {
+		_, err := v.Watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// The previous value stays in use until the variable recovers.
+			r.log(ctx, slog.LevelWarn, "viettelpay watch failed", slog.String("error", err.Error()))
+			continue
+		}
+
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *ReloadingPartnerAPI) closeVars() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range r.vars {
+		if cerr := v.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (r *ReloadingPartnerAPI) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if r.logger != nil {
+		r.logger.LogAttrs(ctx, level, msg, attrs...)
+	}
+}
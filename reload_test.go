@@ -0,0 +1,62 @@
+package viettelpay_test
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "gocloud.dev/runtimevar/filevar"
+)
+
+func TestReloadingPartnerAPI(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	fileVar := func(name, val string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(val), 0o600))
+		return "file://" + filepath.ToSlash(path) + "?decoder=string"
+	}
+	t.Setenv("VIETTELPAY_BASE_URL", constantVar(srv.URL))
+	t.Setenv("VIETTELPAY_USERNAME", constantVar("partner"))
+	t.Setenv("VIETTELPAY_SERVICE_CODE", constantVar("PARTNER"))
+	t.Setenv("VIETTELPAY_PASSWORD", fileVar("password", "expired"))
+	t.Setenv("VIETTELPAY_PARTNER_PRIVATE_KEY", constantVar(string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: srv.Keys.PartnerPrivateKey}))))
+	t.Setenv("VIETTELPAY_VIETTEL_PUBLIC_KEY", fileVar("viettel.pem", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: srv.Keys.ViettelPublicKey}))))
+
+	ctx := context.Background()
+	api, err := viettelpay.ProvideReloadingPartnerAPI(ctx, srv.HTTP.Client())
+	require.NoError(t, err)
+	defer api.Close()
+
+	check := viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Nguyen Van A"}
+	_, err = api.CheckAccount(ctx, viettelpay.GenOrderID(), check)
+	require.True(t, errors.Is(err, &viettelpay.Error{Code: emulator.CodeAuthFailed}))
+
+	// Rotate the password.
+	fileVar("password", "partner")
+	require.Eventually(t, func() bool {
+		return api.Config().Password == "partner"
+	}, 10*time.Second, 10*time.Millisecond)
+	_, err = api.CheckAccount(ctx, viettelpay.GenOrderID(), check)
+	require.NoError(t, err)
+
+	// A broken key is not applied.
+	cfg := api.Config()
+	fileVar("viettel.pem", "not a key")
+	time.Sleep(200 * time.Millisecond)
+	assert.Same(t, cfg, api.Config())
+	_, err = api.CheckAccount(ctx, viettelpay.GenOrderID(), check)
+	assert.NoError(t, err)
+}
@@ -14,6 +14,10 @@ type Request interface {
 }
 
 func NewRequest(cmd string, data interface{}, env Envelope) Request {
+	if env == nil {
+		env = &EnvelopeBase{}
+	}
+
 	return &request{
 		cmd:      cmd,
 		data:     data,
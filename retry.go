@@ -0,0 +1,164 @@
+package viettelpay
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"giautm.dev/viettelpay/soap"
+)
+
+// RetryPolicy configures how failed SOAP calls are repeated. Only read-only
+// commands are retried; VTP306 (RequestDisbursement) is never retried
+// automatically, see SafeRequestDisbursement instead.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of calls, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after each retry.
+	Multiplier float64
+	// Jitter is the fraction of the delay which is randomized, from 0 to 1.
+	Jitter float64
+	// Commands lists the commands to retry. Default is VTP305 and VTP307.
+	Commands []string
+}
+
+// DefaultRetryPolicy retries VTP305 and VTP307 up to 4 times.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// WithRetryPolicy is an Option to retry read-only commands on transient
+// SOAP and HTTP failures
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retryPolicy = &policy
+	}
+}
+
+func (p *RetryPolicy) retries(cmd string) bool {
+	if p == nil || p.MaxAttempts <= 1 || cmd == "VTP306" {
+		return false
+	}
+
+	commands := p.Commands
+	if len(commands) == 0 {
+		commands = []string{"VTP305", "VTP307"}
+	}
+	for _, c := range commands {
+		if c == cmd {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(d)
+}
+
+// callWithRetry calls fn, and repeats it while the error is transient and
+// the policy allows it.
+func (s *partnerAPI) callWithRetry(ctx context.Context, cmd string, fn func() error) error {
+	err := fn()
+	if !s.retryPolicy.retries(cmd) {
+		return err
+	}
+
+	for attempt := 1; attempt < s.retryPolicy.MaxAttempts && isTransient(ctx, err); attempt++ {
+		d := s.retryPolicy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+			return err
+		}
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+
+		err = fn()
+	}
+
+	return err
+}
+
+// isTransient reports whether a failed call may succeed if repeated.
+func isTransient(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var httpErr *soap.HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		case http.StatusInternalServerError:
+			return isServerFault(faultCode(httpErr.ResponseBody))
+		}
+		return false
+	}
+
+	var fault *soap.SOAPFault
+	if errors.As(err, &fault) {
+		return isServerFault(fault.Code)
+	}
+
+	var netErr net.Error
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func isServerFault(code string) bool {
+	if i := strings.LastIndexByte(code, ':'); i >= 0 {
+		code = code[i+1:]
+	}
+	return code == "Server" || code == "Receiver"
+}
+
+func faultCode(body []byte) string {
+	var envelope struct {
+		Body struct {
+			Fault struct {
+				Code string `xml:"faultcode"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		return ""
+	}
+
+	return envelope.Body.Fault.Code
+}
@@ -0,0 +1,85 @@
+package viettelpay_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const serverFault = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>busy</faultstring></soap:Fault></soap:Body></soap:Envelope>`
+
+func TestWithRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		failures  int
+		disburse  bool
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "503 then success", status: http.StatusServiceUnavailable, failures: 2, wantCalls: 3},
+		{name: "server fault", status: http.StatusInternalServerError, body: serverFault, failures: 1, wantCalls: 2},
+		{name: "too many failures", status: http.StatusBadGateway, failures: 10, wantCalls: 4, wantErr: true},
+		{name: "not transient", status: http.StatusBadRequest, failures: 1, wantCalls: 1, wantErr: true},
+		{name: "never VTP306", status: http.StatusServiceUnavailable, failures: 1, disburse: true, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := emulator.NewServer()
+			require.NoError(t, err)
+			defer srv.Close()
+
+			calls := 0
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				r.Body = io.NopCloser(bytes.NewReader(body))
+
+				calls++
+				if calls <= tt.failures {
+					w.WriteHeader(tt.status)
+					_, _ = w.Write([]byte(tt.body))
+					return
+				}
+				srv.ServeHTTP(w, r)
+			}))
+			defer proxy.Close()
+
+			keyStore, err := srv.Keys.PartnerKeyStore()
+			require.NoError(t, err)
+			api, err := viettelpay.NewPartnerAPI(proxy.URL,
+				viettelpay.WithAuth("partner", "partner", "PARTNER"),
+				viettelpay.WithKeyStore(keyStore),
+				viettelpay.WithRetryPolicy(viettelpay.RetryPolicy{
+					MaxAttempts:    4,
+					InitialBackoff: time.Millisecond,
+					Multiplier:     2,
+					Jitter:         0.5,
+				}),
+			)
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			if tt.disburse {
+				_, err = api.RequestDisbursement(ctx, viettelpay.GenOrderID(), "Test", viettelpay.RequestDisbursement{
+					TransactionID: viettelpay.GenOrderID(), MSISDN: "84365233899", CustomerName: "Nguyen Van A", Amount: 1000,
+				})
+			} else {
+				_, err = api.CheckAccount(ctx, viettelpay.GenOrderID(), viettelpay.CheckAccount{
+					MSISDN: "84365233899", CustomerName: "Nguyen Van A",
+				})
+			}
+			assert.Equal(t, tt.wantErr, err != nil, "err = %v", err)
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package viettelpay
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DisbursementOutcome is the outcome of SafeRequestDisbursement.
+type DisbursementOutcome int
+
+const (
+	// OutcomeUnknown means the order could not be reconciled, it may or
+	// may not have been accepted. It must not be submitted with a new
+	// orderID before it is reconciled.
+	OutcomeUnknown DisbursementOutcome = iota
+	// OutcomeSubmitted means the order was submitted and accepted.
+	OutcomeSubmitted
+	// OutcomeAlreadyAccepted means a previous, ambiguous submission of the
+	// order was accepted.
+	OutcomeAlreadyAccepted
+	// OutcomeRejected means the order was definitively rejected.
+	OutcomeRejected
+)
+
+func (o DisbursementOutcome) String() string {
+	switch o {
+	case OutcomeSubmitted:
+		return "Submitted"
+	case OutcomeAlreadyAccepted:
+		return "AlreadyAccepted"
+	case OutcomeRejected:
+		return "Rejected"
+	}
+	return "Unknown"
+}
+
+// SafeDisbursement is the result of SafeRequestDisbursement.
+type SafeDisbursement struct {
+	Outcome DisbursementOutcome
+	// Responses is set when the order was submitted or rejected.
+	Responses []RequestDisbursementResponse
+	// Results and BatchStatus are set when the order was reconciled by
+	// QueryRequests.
+	Results     []QueryRequestsResponse
+	BatchStatus BatchStatus
+	// Attempts is the number of RequestDisbursement calls.
+	Attempts int
+}
+
+type safeOptions struct {
+	submitAttempts    int
+	reconcileAttempts int
+	reconcileDelay    time.Duration
+	reconcileTimeout  time.Duration
+}
+
+var defaultSafeOptions = safeOptions{
+	submitAttempts:    3,
+	reconcileAttempts: 3,
+	reconcileDelay:    2 * time.Second,
+	reconcileTimeout:  30 * time.Second,
+}
+
+// A SafeOption sets options such as attempts, delays, etc.
+type SafeOption func(*safeOptions)
+
+// WithSubmitAttempts is a SafeOption to set how many times an order which
+// was not accepted is submitted
+func WithSubmitAttempts(n int) SafeOption {
+	return func(o *safeOptions) {
+		o.submitAttempts = n
+	}
+}
+
+// WithReconcileAttempts is a SafeOption to set how many times QueryRequests
+// is called to reconcile an ambiguous submission
+func WithReconcileAttempts(n int) SafeOption {
+	return func(o *safeOptions) {
+		o.reconcileAttempts = n
+	}
+}
+
+// WithReconcileDelay is a SafeOption to set the delay before each
+// QueryRequests call, to let Viettel record the submission
+func WithReconcileDelay(d time.Duration) SafeOption {
+	return func(o *safeOptions) {
+		o.reconcileDelay = d
+	}
+}
+
+// WithReconcileTimeout is a SafeOption to set how long an order is
+// reconciled after the context of SafeRequestDisbursement is done
+func WithReconcileTimeout(d time.Duration) SafeOption {
+	return func(o *safeOptions) {
+		o.reconcileTimeout = d
+	}
+}
+
+// SafeRequestDisbursement calls RequestDisbursement without risking a double
+// payment. When the call fails, with an error answer from Viettel or without
+// any, such as a transport error or a context deadline, it calls
+// QueryRequests for the same orderID. An error answer is reported as
+// OutcomeRejected only when Viettel has no batch status for the order, and
+// the order is submitted again only when the call got no answer and Viettel
+// has no batch status for it. When ctx is done, the order is still
+// reconciled, on a context detached from ctx, but it is not submitted again.
+//
+// These decisions do not depend on the error codes of Viettel, so they hold
+// for codes which are not registered in the catalog.
+func SafeRequestDisbursement(ctx context.Context, api PartnerAPI, orderID string, transactionContent string, reqs []RequestDisbursement, opts ...SafeOption) (*SafeDisbursement, error) {
+	o := defaultSafeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	res := &SafeDisbursement{}
+	for res.Attempts < o.submitAttempts {
+		res.Attempts++
+
+		responses, err := api.RequestDisbursement(ctx, orderID, transactionContent, reqs...)
+		if err == nil {
+			res.Outcome, res.Responses = OutcomeSubmitted, responses
+			return res, nil
+		} else if errors.Is(err, ErrLedgerMismatch) {
+			return res, err
+		}
+		// An error answer may be a rejection of the order, or of a
+		// duplicate of an order which was accepted. Only QueryRequests
+		// tells them apart.
+		var vtpErr *Error
+		rejected := errors.As(err, &vtpErr)
+
+		rctx := ctx
+		if ctx.Err() != nil {
+			var cancel context.CancelFunc
+			rctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), o.reconcileTimeout)
+			defer cancel()
+		}
+
+		accepted, qerr := reconcile(rctx, api, orderID, res, &o)
+		if qerr != nil {
+			return res, qerr
+		} else if accepted {
+			res.Outcome = OutcomeAlreadyAccepted
+			return res, nil
+		} else if rejected {
+			res.Outcome, res.Responses = OutcomeRejected, responses
+			return res, err
+		} else if err = ctx.Err(); err != nil {
+			return res, err
+		}
+	}
+
+	return res, errors.New("viettelpay: order was not accepted after all submit attempts")
+}
+
+// reconcile reports whether Viettel knows the order. An error answer
+// without a batch status means Viettel does not know it.
+func reconcile(ctx context.Context, api PartnerAPI, orderID string, res *SafeDisbursement, o *safeOptions) (bool, error) {
+	var err error
+	for i := 0; i < o.reconcileAttempts; i++ {
+		t := time.NewTimer(o.reconcileDelay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return false, ctx.Err()
+		}
+
+		var results []QueryRequestsResponse
+		var status BatchStatus
+		results, status, err = api.QueryRequests(ctx, orderID, nil)
+		if status != BatchUnknown {
+			res.Results, res.BatchStatus = results, status
+			return true, nil
+		}
+		var vtpErr *Error
+		if errors.As(err, &vtpErr) {
+			return false, nil
+		}
+	}
+	if err == nil {
+		err = errors.New("viettelpay: no batch status for order")
+	}
+
+	return false, err
+}
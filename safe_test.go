@@ -0,0 +1,222 @@
+package viettelpay_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyClient fails the first VTP306 call, before or after it reached
+// the server.
+type flakyClient struct {
+	client    viettelpay.HTTPClient
+	delivered bool
+	failed    bool
+}
+
+func (c *flakyClient) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if c.failed || !bytes.Contains(body, []byte("<cmd>VTP306</cmd>")) {
+		return c.client.Do(req)
+	}
+	c.failed = true
+
+	if c.delivered {
+		res, err := c.client.Do(req)
+		if err == nil {
+			res.Body.Close()
+		}
+	}
+	return nil, errors.New("connection reset by peer")
+}
+
+// slowClient delivers the VTP306 call, but answers only after the context
+// of the request is done.
+type slowClient struct {
+	client viettelpay.HTTPClient
+}
+
+func (c *slowClient) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if !bytes.Contains(body, []byte("<cmd>VTP306</cmd>")) {
+		return c.client.Do(req)
+	}
+
+	res, err := c.client.Do(req.WithContext(context.Background()))
+	if err == nil {
+		res.Body.Close()
+	}
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestSafeRequestDisbursement(t *testing.T) {
+	reqs := []viettelpay.RequestDisbursement{
+		{TransactionID: viettelpay.GenOrderID(), MSISDN: "84365233899", CustomerName: "Nguyen Van A", Amount: 1000},
+	}
+
+	tests := []struct {
+		name      string
+		delivered bool
+		want      viettelpay.DisbursementOutcome
+		attempts  int
+	}{
+		{name: "response lost", delivered: true, want: viettelpay.OutcomeAlreadyAccepted, attempts: 1},
+		{name: "request lost", delivered: false, want: viettelpay.OutcomeSubmitted, attempts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := emulator.NewServer()
+			require.NoError(t, err)
+			defer srv.Close()
+
+			api, err := srv.PartnerAPI(viettelpay.WithHTTPClient(&flakyClient{
+				client:    srv.HTTP.Client(),
+				delivered: tt.delivered,
+			}))
+			require.NoError(t, err)
+
+			orderID := viettelpay.GenOrderID()
+			res, err := viettelpay.SafeRequestDisbursement(context.Background(), api, orderID, "Test", reqs,
+				viettelpay.WithReconcileDelay(time.Millisecond))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, res.Outcome)
+			assert.Equal(t, tt.attempts, res.Attempts)
+			assert.Len(t, srv.Disbursements(orderID), 1)
+		})
+	}
+}
+
+func TestSafeRequestDisbursement_Deadline(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	api, err := srv.PartnerAPI(viettelpay.WithHTTPClient(&slowClient{client: srv.HTTP.Client()}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	orderID := viettelpay.GenOrderID()
+	res, err := viettelpay.SafeRequestDisbursement(ctx, api, orderID, "Test",
+		[]viettelpay.RequestDisbursement{
+			{TransactionID: viettelpay.GenOrderID(), MSISDN: "84365233899", CustomerName: "Nguyen Van A", Amount: 1000},
+		},
+		viettelpay.WithReconcileDelay(time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, viettelpay.OutcomeAlreadyAccepted, res.Outcome)
+	assert.Equal(t, 1, res.Attempts)
+	assert.Len(t, srv.Disbursements(orderID), 1)
+}
+
+func TestSafeRequestDisbursement_Rejected(t *testing.T) {
+	srv, err := emulator.NewServer(emulator.WithBalance(10))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	api, err := srv.PartnerAPI()
+	require.NoError(t, err)
+
+	res, err := viettelpay.SafeRequestDisbursement(context.Background(), api, viettelpay.GenOrderID(), "Test",
+		[]viettelpay.RequestDisbursement{
+			{TransactionID: viettelpay.GenOrderID(), MSISDN: "84365233899", CustomerName: "Nguyen Van A", Amount: 1000},
+		},
+		viettelpay.WithReconcileDelay(time.Millisecond))
+	var vtpErr *viettelpay.Error
+	require.True(t, errors.As(err, &vtpErr))
+	assert.Equal(t, emulator.CodeInsufficientBalance, vtpErr.Code)
+	assert.Equal(t, viettelpay.OutcomeRejected, res.Outcome)
+}
+
+// scriptedAPI answers the VTP306 and VTP307 calls with the given errors,
+// in order, and with status once the order is accepted.
+type scriptedAPI struct {
+	viettelpay.PartnerAPI
+	submits []error
+	queries []error
+	status  viettelpay.BatchStatus
+	calls   int
+}
+
+func (a *scriptedAPI) RequestDisbursement(ctx context.Context, orderID string, transactionContent string, reqs ...viettelpay.RequestDisbursement) ([]viettelpay.RequestDisbursementResponse, error) {
+	err := a.submits[a.calls]
+	a.calls++
+	return nil, err
+}
+
+func (a *scriptedAPI) QueryRequests(ctx context.Context, orderID string, query viettelpay.QueryRequests) ([]viettelpay.QueryRequestsResponse, viettelpay.BatchStatus, error) {
+	err := a.queries[0]
+	a.queries = a.queries[1:]
+	if err == nil {
+		return nil, a.status, a.status.Err()
+	}
+	return nil, viettelpay.BatchUnknown, err
+}
+
+func TestSafeRequestDisbursement_UnregisteredCodes(t *testing.T) {
+	lost := errors.New("connection reset by peer")
+	// The codes are not in the catalog, the outcome must not depend on them.
+	refused := &viettelpay.Error{Code: "X-REFUSED", Desc: "refused"}
+	unknown := &viettelpay.Error{Code: "X-UNKNOWN", Desc: "no such order"}
+
+	tests := []struct {
+		name     string
+		api      *scriptedAPI
+		want     viettelpay.DisbursementOutcome
+		wantErr  error
+		attempts int
+	}{
+		{
+			name:     "duplicate of an accepted order",
+			api:      &scriptedAPI{submits: []error{lost, refused}, queries: []error{unknown, nil}, status: viettelpay.BatchPending},
+			want:     viettelpay.OutcomeAlreadyAccepted,
+			attempts: 2,
+		},
+		{
+			name:     "rejected",
+			api:      &scriptedAPI{submits: []error{refused}, queries: []error{unknown}},
+			want:     viettelpay.OutcomeRejected,
+			wantErr:  refused,
+			attempts: 1,
+		},
+		{
+			name:     "request lost",
+			api:      &scriptedAPI{submits: []error{lost, nil}, queries: []error{unknown}},
+			want:     viettelpay.OutcomeSubmitted,
+			attempts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := viettelpay.SafeRequestDisbursement(context.Background(), tt.api, viettelpay.GenOrderID(), "Test", nil,
+				viettelpay.WithReconcileDelay(time.Millisecond))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, res.Outcome)
+			assert.Equal(t, tt.attempts, res.Attempts)
+		})
+	}
+}
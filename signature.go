@@ -0,0 +1,131 @@
+package viettelpay
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+	"time"
+
+	// Register the supported hash functions.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// SignatureScheme is the algorithm used to sign requests or to verify
+// responses.
+type SignatureScheme struct {
+	Hash crypto.Hash
+	// PSS selects RSASSA-PSS instead of PKCS#1 v1.5.
+	PSS bool
+}
+
+// Signature schemes supported by the KeyStore. The partner API historically
+// uses SHA1WithRSA.
+var (
+	SHA1WithRSA      = SignatureScheme{Hash: crypto.SHA1}
+	SHA256WithRSA    = SignatureScheme{Hash: crypto.SHA256}
+	SHA512WithRSA    = SignatureScheme{Hash: crypto.SHA512}
+	SHA1WithRSAPSS   = SignatureScheme{Hash: crypto.SHA1, PSS: true}
+	SHA256WithRSAPSS = SignatureScheme{Hash: crypto.SHA256, PSS: true}
+	SHA512WithRSAPSS = SignatureScheme{Hash: crypto.SHA512, PSS: true}
+)
+
+var signatureSchemes = []SignatureScheme{
+	SHA1WithRSA, SHA256WithRSA, SHA512WithRSA,
+	SHA1WithRSAPSS, SHA256WithRSAPSS, SHA512WithRSAPSS,
+}
+
+// ParseSignatureScheme parses the name of a SignatureScheme, such as
+// "SHA256WithRSA" or "SHA256WithRSAPSS". The case is ignored.
+func ParseSignatureScheme(name string) (SignatureScheme, error) {
+	for _, s := range signatureSchemes {
+		if strings.EqualFold(s.String(), name) {
+			return s, nil
+		}
+	}
+
+	return SignatureScheme{}, fmt.Errorf("viettelpay: unknown signature scheme %q", name)
+}
+
+// EnvDecode implements env.Decoder.
+func (s *SignatureScheme) EnvDecode(val string) (err error) {
+	if val == "" {
+		return nil
+	}
+	*s, err = ParseSignatureScheme(val)
+	return err
+}
+
+func (s SignatureScheme) String() string {
+	name := strings.ReplaceAll(s.Hash.String(), "-", "") + "WithRSA"
+	if s.PSS {
+		name += "PSS"
+	}
+	return name
+}
+
+func (s SignatureScheme) validate() error {
+	for _, v := range signatureSchemes {
+		if s == v {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("viettelpay: unsupported signature scheme %s", s)
+}
+
+func (s SignatureScheme) digest(data []byte) []byte {
+	h := s.Hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (s SignatureScheme) sign(signer crypto.Signer, data []byte) ([]byte, error) {
+	var opts crypto.SignerOpts = s.Hash
+	if s.PSS {
+		opts = &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       s.Hash,
+		}
+	}
+	return signer.Sign(rand.Reader, s.digest(data), opts)
+}
+
+func (s SignatureScheme) verify(key *rsa.PublicKey, data, signature []byte) error {
+	if s.PSS {
+		return rsa.VerifyPSS(key, s.Hash, s.digest(data), signature, &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthAuto,
+		})
+	}
+	return rsa.VerifyPKCS1v15(key, s.Hash, s.digest(data), signature)
+}
+
+type keyStoreOptions struct {
+	signScheme   SignatureScheme
+	verifyScheme SignatureScheme
+	trustedKeys  []TrustedKey
+	notAfter     time.Time
+}
+
+// A KeyStoreOption sets options such as the signature schemes.
+type KeyStoreOption func(*keyStoreOptions)
+
+// WithSignScheme is a KeyStoreOption to set the scheme used to sign
+// requests. Default is SHA1WithRSA.
+func WithSignScheme(scheme SignatureScheme) KeyStoreOption {
+	return func(o *keyStoreOptions) {
+		o.signScheme = scheme
+	}
+}
+
+// WithVerifyScheme is a KeyStoreOption to set the scheme used to verify
+// responses. Default is SHA1WithRSA. It is independent of the sign scheme,
+// so both sides can migrate one at a time.
+func WithVerifyScheme(scheme SignatureScheme) KeyStoreOption {
+	return func(o *keyStoreOptions) {
+		o.verifyScheme = scheme
+	}
+}
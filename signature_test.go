@@ -0,0 +1,80 @@
+package viettelpay_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSignatureScheme(t *testing.T) {
+	s, err := viettelpay.ParseSignatureScheme("sha256withrsapss")
+	require.NoError(t, err)
+	assert.Equal(t, viettelpay.SHA256WithRSAPSS, s)
+	assert.Equal(t, "SHA256WithRSAPSS", s.String())
+	assert.Equal(t, "SHA1WithRSA", viettelpay.SHA1WithRSA.String())
+
+	_, err = viettelpay.ParseSignatureScheme("MD5WithRSA")
+	assert.Error(t, err)
+}
+
+func TestSignatureSchemes(t *testing.T) {
+	keys, err := emulator.GenerateKeys(2048)
+	require.NoError(t, err)
+
+	data := []byte(`{"orderId":"ORDER1"}`)
+	for _, scheme := range []viettelpay.SignatureScheme{
+		viettelpay.SHA1WithRSA, viettelpay.SHA256WithRSA, viettelpay.SHA512WithRSA,
+		viettelpay.SHA1WithRSAPSS, viettelpay.SHA256WithRSAPSS, viettelpay.SHA512WithRSAPSS,
+	} {
+		t.Run(scheme.String(), func(t *testing.T) {
+			// The emulator signs what the partner verifies.
+			emu, err := keys.EmulatorKeyStore(viettelpay.WithSignScheme(scheme))
+			require.NoError(t, err)
+			partner, err := keys.PartnerKeyStore(viettelpay.WithVerifyScheme(scheme))
+			require.NoError(t, err)
+
+			sig, err := emu.Sign(data)
+			require.NoError(t, err)
+			assert.NoError(t, partner.Verify(data, sig))
+
+			legacy, err := keys.PartnerKeyStore()
+			require.NoError(t, err)
+			if scheme != viettelpay.SHA1WithRSA {
+				assert.True(t, errors.Is(legacy.Verify(data, sig), rsa.ErrVerification))
+			}
+		})
+	}
+
+	_, err = keys.PartnerKeyStore(viettelpay.WithSignScheme(viettelpay.SignatureScheme{Hash: crypto.MD5}))
+	assert.Error(t, err)
+}
+
+func TestSignatureSchemeMigration(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Viettel verifies SHA-256 while still signing with SHA-1.
+	emuKeyStore, err := srv.Keys.EmulatorKeyStore(viettelpay.WithVerifyScheme(viettelpay.SHA256WithRSA))
+	require.NoError(t, err)
+	emu := emulator.New(emuKeyStore, emulator.WithCredentials("partner", "partner", "PARTNER"))
+	srv.HTTP.Config.Handler = emu
+
+	keyStore, err := srv.Keys.PartnerKeyStore(viettelpay.WithSignScheme(viettelpay.SHA256WithRSA))
+	require.NoError(t, err)
+	api, err := srv.PartnerAPI(viettelpay.WithKeyStore(keyStore))
+	require.NoError(t, err)
+
+	_, err = api.CheckAccount(context.Background(), "ORDER1", viettelpay.CheckAccount{
+		MSISDN:       "84365233899",
+		CustomerName: "Nguyen Van A",
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,89 @@
+package viettelpay_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// remoteSigner hides the private key behind crypto.Signer, as a PKCS#11
+// module or a signing sidecar would.
+type remoteSigner struct {
+	key   *rsa.PrivateKey
+	calls int
+}
+
+func (s *remoteSigner) Public() crypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s *remoteSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.calls++
+	return s.key.Sign(rand, digest, opts)
+}
+
+func TestNewSignerKeyStore(t *testing.T) {
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	key, err := viettelpay.ParsePrivateKey(srv.Keys.PartnerPrivateKey)
+	require.NoError(t, err)
+	signer := &remoteSigner{key: key}
+
+	keyStore, err := viettelpay.NewSignerKeyStore(signer, nil, srv.Keys.ViettelPublicKey)
+	require.NoError(t, err)
+	api, err := srv.PartnerAPI(viettelpay.WithKeyStore(keyStore))
+	require.NoError(t, err)
+
+	_, err = api.CheckAccount(context.Background(), "ORDER1", viettelpay.CheckAccount{MSISDN: "84365233899", CustomerName: "Nguyen Van A"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, signer.calls)
+
+	_, err = keyStore.Decrypt([]byte("secret"))
+	assert.True(t, errors.Is(err, viettelpay.ErrNoDecrypter))
+
+	t.Run("PSS", func(t *testing.T) {
+		keyStore, err := viettelpay.NewSignerKeyStore(signer, nil, srv.Keys.ViettelPublicKey,
+			viettelpay.WithSignScheme(viettelpay.SHA256WithRSAPSS))
+		require.NoError(t, err)
+		emuKeyStore, err := srv.Keys.EmulatorKeyStore(viettelpay.WithVerifyScheme(viettelpay.SHA256WithRSAPSS))
+		require.NoError(t, err)
+
+		sig, err := keyStore.Sign([]byte("data"))
+		require.NoError(t, err)
+		assert.NoError(t, emuKeyStore.Verify([]byte("data"), sig))
+	})
+
+	t.Run("decrypter", func(t *testing.T) {
+		keyStore, err := viettelpay.NewSignerKeyStore(signer, key, srv.Keys.ViettelPublicKey)
+		require.NoError(t, err)
+		emuKeyStore, err := srv.Keys.EmulatorKeyStore()
+		require.NoError(t, err)
+
+		encrypted, err := emuKeyStore.Encrypt([]byte("secret"))
+		require.NoError(t, err)
+		decrypted, err := keyStore.Decrypt([]byte(encrypted))
+		require.NoError(t, err)
+		assert.Equal(t, "secret", decrypted)
+	})
+
+	t.Run("not RSA", func(t *testing.T) {
+		ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		_, err = viettelpay.NewSignerKeyStore(ecKey, nil, srv.Keys.ViettelPublicKey)
+		assert.True(t, errors.Is(err, viettelpay.ErrUnsupportedKey))
+	})
+}
@@ -0,0 +1,282 @@
+// Package sqliteledger implements viettelpay.Ledger on top of an embedded,
+// pure-Go SQLite database.
+package sqliteledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"giautm.dev/viettelpay"
+
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS orders (
+	order_id     TEXT PRIMARY KEY,
+	trans_content TEXT NOT NULL,
+	state        TEXT NOT NULL,
+	batch_status TEXT NOT NULL,
+	error_code   TEXT NOT NULL,
+	error_desc   TEXT NOT NULL,
+	created_at   INTEGER NOT NULL,
+	updated_at   INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS entries (
+	trans_id      TEXT PRIMARY KEY,
+	order_id      TEXT NOT NULL REFERENCES orders (order_id),
+	line          INTEGER NOT NULL,
+	msisdn        TEXT NOT NULL,
+	customer_name TEXT NOT NULL,
+	amount        INTEGER NOT NULL,
+	sms_content   TEXT NOT NULL,
+	note          TEXT NOT NULL,
+	state         TEXT NOT NULL,
+	error_code    TEXT NOT NULL,
+	error_desc    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS entries_order_id ON entries (order_id, line);
+CREATE INDEX IF NOT EXISTS orders_state ON orders (state);
+`
+
+// Ledger is a viettelpay.Ledger stored in SQLite.
+type Ledger struct {
+	db *sql.DB
+}
+
+var _ viettelpay.Ledger = (*Ledger)(nil)
+
+// Open opens the SQLite database at path and creates the ledger tables.
+func Open(ctx context.Context, path string) (*Ledger, error) {
+	dsn := url.URL{
+		Scheme:   "file",
+		Path:     path,
+		RawQuery: "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)",
+	}
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := New(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// New creates the ledger tables in db, if they do not exist yet.
+func New(ctx context.Context, db *sql.DB) (*Ledger, error) {
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, err
+	}
+
+	return &Ledger{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (l *Ledger) Close() error {
+	return l.db.Close()
+}
+
+func (l *Ledger) Create(ctx context.Context, order *viettelpay.LedgerOrder) error {
+	return l.tx(ctx, func(tx *sql.Tx) error {
+		var n int
+		err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders WHERE order_id = ?`, order.OrderID).Scan(&n)
+		if err != nil {
+			return err
+		} else if n > 0 {
+			return viettelpay.ErrLedgerDuplicate
+		}
+		for _, e := range order.Entries {
+			err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM entries WHERE trans_id = ?`, e.TransactionID).Scan(&n)
+			if err != nil {
+				return err
+			} else if n > 0 {
+				return viettelpay.ErrLedgerDuplicate
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO orders
+			(order_id, trans_content, state, batch_status, error_code, error_desc, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			order.OrderID, order.TransactionContent, string(order.State), order.BatchStatus.Code(),
+			order.ErrorCode, order.ErrorDesc, order.CreatedAt.UnixNano(), order.UpdatedAt.UnixNano(),
+		)
+		if err != nil {
+			return err
+		}
+
+		return insertEntries(ctx, tx, order)
+	})
+}
+
+func (l *Ledger) Update(ctx context.Context, order *viettelpay.LedgerOrder) error {
+	return l.tx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `UPDATE orders SET
+			trans_content = ?, state = ?, batch_status = ?, error_code = ?, error_desc = ?, updated_at = ?
+			WHERE order_id = ?`,
+			order.TransactionContent, string(order.State), order.BatchStatus.Code(),
+			order.ErrorCode, order.ErrorDesc, order.UpdatedAt.UnixNano(), order.OrderID,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return viettelpay.ErrLedgerNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM entries WHERE order_id = ?`, order.OrderID)
+		if err != nil {
+			return err
+		}
+
+		return insertEntries(ctx, tx, order)
+	})
+}
+
+func (l *Ledger) Order(ctx context.Context, orderID string) (*viettelpay.LedgerOrder, error) {
+	row := l.db.QueryRowContext(ctx, `SELECT
+		order_id, trans_content, state, batch_status, error_code, error_desc, created_at, updated_at
+		FROM orders WHERE order_id = ?`, orderID)
+
+	order, err := scanOrder(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, viettelpay.ErrLedgerNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if order.Entries, err = l.entries(ctx, `WHERE order_id = ? ORDER BY line`, orderID); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (l *Ledger) Transaction(ctx context.Context, transactionID string) (*viettelpay.LedgerEntry, error) {
+	entries, err := l.entries(ctx, `WHERE trans_id = ?`, transactionID)
+	if err != nil {
+		return nil, err
+	} else if len(entries) == 0 {
+		return nil, viettelpay.ErrLedgerNotFound
+	}
+
+	return &entries[0], nil
+}
+
+func (l *Ledger) Unfinished(ctx context.Context) ([]*viettelpay.LedgerOrder, error) {
+	rows, err := l.db.QueryContext(ctx, `SELECT
+		order_id, trans_content, state, batch_status, error_code, error_desc, created_at, updated_at
+		FROM orders WHERE state NOT IN (?, ?, ?) ORDER BY created_at`,
+		string(viettelpay.LedgerRejected), string(viettelpay.LedgerSucceeded), string(viettelpay.LedgerFailed),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []*viettelpay.LedgerOrder{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, order := range orders {
+		if order.Entries, err = l.entries(ctx, `WHERE order_id = ? ORDER BY line`, order.OrderID); err != nil {
+			return nil, err
+		}
+	}
+
+	return orders, nil
+}
+
+func (l *Ledger) tx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (l *Ledger) entries(ctx context.Context, where string, args ...interface{}) ([]viettelpay.LedgerEntry, error) {
+	rows, err := l.db.QueryContext(ctx, `SELECT
+		trans_id, order_id, msisdn, customer_name, amount, sms_content, note, state, error_code, error_desc
+		FROM entries `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []viettelpay.LedgerEntry{}
+	for rows.Next() {
+		var e viettelpay.LedgerEntry
+		var state string
+		err = rows.Scan(&e.TransactionID, &e.OrderID, &e.MSISDN, &e.CustomerName, &e.Amount,
+			&e.SMSContent, &e.Note, &state, &e.ErrorCode, &e.ErrorDesc)
+		if err != nil {
+			return nil, err
+		}
+		e.State = viettelpay.LedgerState(state)
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+func insertEntries(ctx context.Context, tx *sql.Tx, order *viettelpay.LedgerOrder) error {
+	for i, e := range order.Entries {
+		_, err := tx.ExecContext(ctx, `INSERT INTO entries
+			(trans_id, order_id, line, msisdn, customer_name, amount, sms_content, note, state, error_code, error_desc)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.TransactionID, order.OrderID, i, e.MSISDN, e.CustomerName, int64(e.Amount),
+			e.SMSContent, e.Note, string(e.State), e.ErrorCode, e.ErrorDesc,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanOrder(row scanner) (*viettelpay.LedgerOrder, error) {
+	var order viettelpay.LedgerOrder
+	var state, batchStatus string
+	var createdAt, updatedAt int64
+
+	err := row.Scan(&order.OrderID, &order.TransactionContent, &state, &batchStatus,
+		&order.ErrorCode, &order.ErrorDesc, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	order.State = viettelpay.LedgerState(state)
+	order.BatchStatus = viettelpay.ParseBatchStatus(batchStatus)
+	order.CreatedAt = time.Unix(0, createdAt)
+	order.UpdatedAt = time.Unix(0, updatedAt)
+
+	return &order, nil
+}
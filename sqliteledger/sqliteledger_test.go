@@ -0,0 +1,83 @@
+package sqliteledger_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/sqliteledger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedger(t *testing.T) {
+	ctx := context.Background()
+	// The path is not a valid URI as is.
+	path := filepath.Join(t.TempDir(), "ledger #1?.db")
+
+	l, err := sqliteledger.Open(ctx, path)
+	require.NoError(t, err)
+
+	now := time.Now()
+	order := &viettelpay.LedgerOrder{
+		OrderID:            "ORDER1",
+		TransactionContent: "Test",
+		State:              viettelpay.LedgerSubmitted,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+		Entries: []viettelpay.LedgerEntry{
+			{
+				RequestDisbursement: viettelpay.RequestDisbursement{
+					TransactionID: "TRANS1",
+					MSISDN:        "84365233899",
+					CustomerName:  "Nguyen Van A",
+					Amount:        1000,
+				},
+				OrderID: "ORDER1",
+				State:   viettelpay.LedgerSubmitted,
+			},
+		},
+	}
+	require.NoError(t, l.Create(ctx, order))
+	assert.FileExists(t, path)
+	assert.True(t, errors.Is(l.Create(ctx, order), viettelpay.ErrLedgerDuplicate))
+	reused := *order
+	reused.OrderID = "ORDER2"
+	assert.True(t, errors.Is(l.Create(ctx, &reused), viettelpay.ErrLedgerDuplicate))
+	require.NoError(t, l.Close())
+
+	// Reopen to make sure the order is durable.
+	l, err = sqliteledger.Open(ctx, path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	unfinished, err := l.Unfinished(ctx)
+	require.NoError(t, err)
+	require.Len(t, unfinished, 1)
+	assert.Equal(t, order.OrderID, unfinished[0].OrderID)
+	assert.Equal(t, order.Entries, unfinished[0].Entries)
+	assert.True(t, order.CreatedAt.Equal(unfinished[0].CreatedAt))
+
+	order.State = viettelpay.LedgerSucceeded
+	order.BatchStatus = viettelpay.BatchSucceeded
+	order.Entries[0].State = viettelpay.LedgerSucceeded
+	require.NoError(t, l.Update(ctx, order))
+
+	got, err := l.Order(ctx, "ORDER1")
+	require.NoError(t, err)
+	assert.Equal(t, viettelpay.BatchSucceeded, got.BatchStatus)
+
+	entry, err := l.Transaction(ctx, "TRANS1")
+	require.NoError(t, err)
+	assert.Equal(t, viettelpay.LedgerSucceeded, entry.State)
+
+	_, err = l.Order(ctx, "ORDER2")
+	assert.True(t, errors.Is(err, viettelpay.ErrLedgerNotFound))
+
+	unfinished, err = l.Unfinished(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, unfinished)
+}
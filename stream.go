@@ -0,0 +1,186 @@
+package viettelpay
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Errors reported by a Decrypter, wrapped in a CiphertextError.
+var (
+	ErrTruncatedCiphertext = errors.New("viettelpay: truncated ciphertext")
+	ErrMalformedCiphertext = errors.New("viettelpay: malformed ciphertext")
+)
+
+// CiphertextError is returned by a Decrypter when a block of the
+// ciphertext can not be decrypted. It matches either ErrTruncatedCiphertext
+// or ErrMalformedCiphertext with errors.Is.
+type CiphertextError struct {
+	// Block is the index of the failing block.
+	Block int
+	Kind  error
+	Err   error
+}
+
+var _ error = (*CiphertextError)(nil)
+
+func (e *CiphertextError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%v at block %d", e.Kind, e.Block)
+	}
+	return fmt.Sprintf("%v at block %d: %v", e.Kind, e.Block, e.Err)
+}
+
+func (e *CiphertextError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Encrypter is an io.WriteCloser encrypting what is written to it the way
+// the partner API expects passwords: the plaintext is split in chunks as
+// large as the key allows, each chunk is encrypted with PKCS#1 v1.5, byte
+// reversed and base64 encoded on its own.
+//
+// Close must be called to flush the last chunk. It does not close the
+// underlying writer.
+type Encrypter struct {
+	dst    io.Writer
+	key    *rsa.PublicKey
+	buf    []byte
+	n      int
+	err    error
+	closed bool
+}
+
+var _ io.WriteCloser = (*Encrypter)(nil)
+
+// NewEncrypter creates an Encrypter writing the ciphertext to dst.
+func NewEncrypter(dst io.Writer, key *rsa.PublicKey) *Encrypter {
+	// See EncryptPKCS1v15 description for max length
+	return &Encrypter{
+		dst: dst,
+		key: key,
+		buf: make([]byte, key.Size()-11),
+	}
+}
+
+func (e *Encrypter) Write(p []byte) (written int, err error) {
+	if e.closed {
+		return 0, errors.New("viettelpay: write to closed Encrypter")
+	} else if e.err != nil {
+		return 0, e.err
+	}
+
+	for len(p) > 0 {
+		if e.n == len(e.buf) {
+			if e.err = e.flush(); e.err != nil {
+				return written, e.err
+			}
+		}
+
+		n := copy(e.buf[e.n:], p)
+		e.n += n
+		written += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// Close encrypts the buffered chunk, if any.
+func (e *Encrypter) Close() error {
+	if e.closed || e.err != nil {
+		return e.err
+	}
+	e.closed = true
+
+	if e.n > 0 {
+		e.err = e.flush()
+	}
+	return e.err
+}
+
+func (e *Encrypter) flush() error {
+	ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, e.key, e.buf[:e.n])
+	if err != nil {
+		return err
+	}
+	e.n = 0
+
+	reverseBytes(ciphertext)
+	_, err = io.WriteString(e.dst, base64.StdEncoding.EncodeToString(ciphertext))
+	return err
+}
+
+// Decrypter is an io.Reader decrypting the ciphertext written by an
+// Encrypter.
+type Decrypter struct {
+	src   io.Reader
+	key   crypto.Decrypter
+	block []byte
+	buf   bytes.Buffer
+	index int
+	err   error
+}
+
+var _ io.Reader = (*Decrypter)(nil)
+
+// NewDecrypter creates a Decrypter reading the ciphertext from src. The
+// key must be a RSA key.
+func NewDecrypter(src io.Reader, key crypto.Decrypter) *Decrypter {
+	d := &Decrypter{src: src, key: key}
+	if pub, ok := key.Public().(*rsa.PublicKey); ok {
+		d.block = make([]byte, base64.StdEncoding.EncodedLen(pub.Size()))
+	} else {
+		d.err = fmt.Errorf("%w: %T", ErrUnsupportedKey, key.Public())
+	}
+
+	return d
+}
+
+func (d *Decrypter) Read(p []byte) (int, error) {
+	for d.buf.Len() == 0 && d.err == nil {
+		d.err = d.next()
+	}
+	if d.buf.Len() > 0 {
+		return d.buf.Read(p)
+	}
+
+	return 0, d.err
+}
+
+// next decrypts the next block of the ciphertext into buf.
+func (d *Decrypter) next() error {
+	n, err := io.ReadFull(d.src, d.block)
+	if err == io.EOF {
+		return io.EOF
+	} else if err == io.ErrUnexpectedEOF {
+		return &CiphertextError{Block: d.index, Kind: ErrTruncatedCiphertext,
+			Err: fmt.Errorf("got %d of %d bytes", n, len(d.block))}
+	} else if err != nil {
+		return err
+	}
+
+	ciphertext := make([]byte, base64.StdEncoding.DecodedLen(len(d.block)))
+	n, err = base64.StdEncoding.Decode(ciphertext, d.block)
+	if err != nil {
+		return &CiphertextError{Block: d.index, Kind: ErrMalformedCiphertext, Err: err}
+	}
+
+	reverseBytes(ciphertext[:n])
+	plaintext, err := d.key.Decrypt(rand.Reader, ciphertext[:n], &rsa.PKCS1v15DecryptOptions{})
+	if err != nil {
+		return &CiphertextError{Block: d.index, Kind: ErrMalformedCiphertext, Err: err}
+	}
+
+	d.index++
+	d.buf.Write(plaintext)
+	return nil
+}
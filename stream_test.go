@@ -0,0 +1,78 @@
+package viettelpay_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"giautm.dev/viettelpay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncrypterDecrypter(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	maxLength := key.Size() - 11
+
+	for name, plaintext := range map[string]string{
+		"empty":          "",
+		"simple block":   "abcxyz",
+		"exact block":    strings.Repeat("a", maxLength),
+		"exact 2 blocks": strings.Repeat("a", 2*maxLength),
+		"partial block":  strings.Repeat("abcxyz", 100),
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			enc := viettelpay.NewEncrypter(buf, &key.PublicKey)
+			// Short reads from src must not lose data.
+			_, err := io.Copy(enc, iotest.OneByteReader(strings.NewReader(plaintext)))
+			require.NoError(t, err)
+			require.NoError(t, enc.Close())
+
+			blocks := (len(plaintext) + maxLength - 1) / maxLength
+			assert.Equal(t, blocks*172, buf.Len())
+
+			got, err := io.ReadAll(viettelpay.NewDecrypter(iotest.HalfReader(buf), key))
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, string(got))
+		})
+	}
+}
+
+func TestDecrypterErrors(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, viettelpay.Encrypt(buf, strings.NewReader(strings.Repeat("abcxyz", 30)), 180, &key.PublicKey))
+	ciphertext := buf.String()
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := io.ReadAll(viettelpay.NewDecrypter(strings.NewReader(ciphertext[:len(ciphertext)-10]), key))
+		assert.True(t, errors.Is(err, viettelpay.ErrTruncatedCiphertext))
+
+		var ctErr *viettelpay.CiphertextError
+		require.True(t, errors.As(err, &ctErr))
+		assert.Equal(t, 1, ctErr.Block)
+	})
+
+	t.Run("invalid base64", func(t *testing.T) {
+		_, err := io.ReadAll(viettelpay.NewDecrypter(strings.NewReader("!"+ciphertext[1:]), key))
+		assert.True(t, errors.Is(err, viettelpay.ErrMalformedCiphertext))
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 1024)
+		require.NoError(t, err)
+
+		_, err = io.ReadAll(viettelpay.NewDecrypter(strings.NewReader(ciphertext), other))
+		assert.True(t, errors.Is(err, viettelpay.ErrMalformedCiphertext))
+		assert.True(t, errors.Is(err, rsa.ErrDecryption))
+	})
+}
@@ -0,0 +1,79 @@
+package viettelpay
+
+import (
+	"reflect"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "giautm.dev/viettelpay"
+
+// Span attributes set on Process spans.
+const (
+	AttrCommand        = attribute.Key("viettelpay.command")
+	AttrOrderID        = attribute.Key("viettelpay.order_id")
+	AttrItems          = attribute.Key("viettelpay.items")
+	AttrTotalAmount    = attribute.Key("viettelpay.total_amount")
+	AttrErrorCode      = attribute.Key("viettelpay.error_code")
+	AttrBatchErrorCode = attribute.Key("viettelpay.batch_error_code")
+	AttrRequestID      = attribute.Key("viettelpay.request_id")
+	AttrKeyID          = attribute.Key("viettelpay.key_id")
+)
+
+// WithTracerProvider is an Option to set the OpenTelemetry TracerProvider.
+// Default is the global TracerProvider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// requestAttributes returns the span attributes describing req.
+func requestAttributes(req Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{AttrCommand.String(req.Command())}
+
+	env := req.Envelope()
+	if b, ok := env.(interface{ envelopeBase() *EnvelopeBase }); ok {
+		attrs = append(attrs, AttrOrderID.String(b.envelopeBase().OrderID))
+	}
+	if v := reflect.ValueOf(req.Data()); v.Kind() == reflect.Slice {
+		attrs = append(attrs, AttrItems.Int(v.Len()))
+	}
+	if e, ok := env.(*RequestDisbursementEnvelope); ok {
+		attrs = append(attrs, AttrTotalAmount.Int64(int64(e.TotalAmount)))
+	}
+
+	return attrs
+}
+
+// responseAttributes returns the span attributes describing res.
+func responseAttributes(res *EnvelopeResponseData) []attribute.KeyValue {
+	if res == nil {
+		return nil
+	}
+
+	return []attribute.KeyValue{
+		AttrErrorCode.String(res.ErrorCode),
+		AttrBatchErrorCode.String(res.BatchErrorCode),
+		AttrRequestID.String(res.RequestId),
+		AttrKeyID.String(res.KeyID),
+	}
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,62 @@
+package viettelpay_test
+
+import (
+	"context"
+	"testing"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWithTracerProvider(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	srv, err := emulator.NewServer()
+	require.NoError(t, err)
+	defer srv.Close()
+
+	api, err := srv.PartnerAPI(viettelpay.WithTracerProvider(tp))
+	require.NoError(t, err)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	orderID := viettelpay.GenOrderID()
+	_, err = api.RequestDisbursement(ctx, orderID, "Test",
+		viettelpay.RequestDisbursement{TransactionID: "T1", MSISDN: "84365233899", CustomerName: "A", Amount: 1000},
+		viettelpay.RequestDisbursement{TransactionID: "T2", MSISDN: "84365233898", CustomerName: "B", Amount: 2500},
+	)
+	require.NoError(t, err)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+
+	process, ok := byName["viettelpay VTP306"]
+	require.True(t, ok)
+	assert.Equal(t, parent.SpanContext().SpanID(), process.Parent.SpanID())
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range process.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	assert.Equal(t, "VTP306", attrs[viettelpay.AttrCommand].AsString())
+	assert.Equal(t, orderID, attrs[viettelpay.AttrOrderID].AsString())
+	assert.Equal(t, int64(2), attrs[viettelpay.AttrItems].AsInt64())
+	assert.Equal(t, int64(3500), attrs[viettelpay.AttrTotalAmount].AsInt64())
+	assert.Equal(t, "00", attrs[viettelpay.AttrErrorCode].AsString())
+	assert.NotEmpty(t, attrs[viettelpay.AttrRequestID].AsString())
+
+	for _, name := range []string{"viettelpay.encrypt", "viettelpay.sign", "viettelpay.soap", "viettelpay.verify"} {
+		child, ok := byName[name]
+		require.True(t, ok, name)
+		assert.Equal(t, process.SpanContext.SpanID(), child.Parent.SpanID(), name)
+	}
+}
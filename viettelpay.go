@@ -4,10 +4,12 @@ import (
 	"context"
 	"crypto/rand"
 	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
 	ulid "github.com/oklog/ulid/v2"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type CheckAccount struct {
@@ -113,7 +115,7 @@ type PartnerAPI interface {
 
 	CheckAccount(ctx context.Context, orderID string, checks ...CheckAccount) ([]CheckAccountResponse, error)
 	RequestDisbursement(ctx context.Context, orderID string, transactionContent string, reqs ...RequestDisbursement) ([]RequestDisbursementResponse, error)
-	QueryRequests(ctx context.Context, orderID string, query QueryRequests) ([]QueryRequestsResponse, error)
+	QueryRequests(ctx context.Context, orderID string, query QueryRequests) ([]QueryRequestsResponse, BatchStatus, error)
 }
 
 func GenOrderID() string {
@@ -133,6 +135,13 @@ type options struct {
 
 	keyStore   KeyStore
 	httpClient HTTPClient
+	ledger     Ledger
+
+	interceptors      []Interceptor
+	logger            *slog.Logger
+	tracerProvider    trace.TracerProvider
+	retryPolicy       *RetryPolicy
+	batchSuccessAsNil bool
 }
 
 // A Option sets options such as credentials, tls, etc.
@@ -161,6 +170,14 @@ func WithKeyStore(keyStore KeyStore) Option {
 	}
 }
 
+// WithBatchSuccessAsNil is an Option to return a nil error instead of
+// ErrBatchDisbSuccess when a batch was disbursed successfully
+func WithBatchSuccessAsNil() Option {
+	return func(o *options) {
+		o.batchSuccessAsNil = true
+	}
+}
+
 type SoapClient interface {
 	CallContext(ctx context.Context, soapAction string, request, response interface{}) error
 }
@@ -172,6 +189,12 @@ type partnerAPI struct {
 
 	client   SoapClient
 	keyStore KeyStore
+	ledger   Ledger
+	invoker  Invoker
+	tracer   trace.Tracer
+
+	retryPolicy       *RetryPolicy
+	batchSuccessAsNil bool
 }
 
 func NewPartnerAPI(url string, opt ...Option) (_ PartnerAPI, err error) {
@@ -184,13 +207,25 @@ func NewPartnerAPI(url string, opt ...Option) (_ PartnerAPI, err error) {
 		return nil, errors.New("missing keyStore option")
 	}
 
-	return &partnerAPI{
+	s := &partnerAPI{
 		client:      newSoapClient(url, opts.httpClient),
 		keyStore:    opts.keyStore,
+		ledger:      opts.ledger,
+		tracer:      newTracer(opts.tracerProvider),
 		username:    opts.username,
 		password:    opts.password,
 		serviceCode: opts.serviceCode,
-	}, nil
+
+		retryPolicy:       opts.retryPolicy,
+		batchSuccessAsNil: opts.batchSuccessAsNil,
+	}
+	interceptors := opts.interceptors
+	if opts.logger != nil {
+		interceptors = append([]Interceptor{logInterceptor(opts.logger)}, interceptors...)
+	}
+	s.invoker = chainInterceptors(interceptors, s.invoke)
+
+	return s, nil
 }
 
 func (s *partnerAPI) CheckAccount(ctx context.Context, orderID string, checks ...CheckAccount) ([]CheckAccountResponse, error) {
@@ -212,12 +247,33 @@ func (s *partnerAPI) RequestDisbursement(ctx context.Context, orderID string, tr
 		env.TotalAmount += v.Amount
 	}
 
+	var order *LedgerOrder
+	var resubmitted bool
+	if s.ledger != nil {
+		var err error
+		if order, resubmitted, err = s.beginDisbursement(ctx, orderID, transactionContent, reqs); err != nil {
+			return nil, err
+		}
+	}
+
 	results := []RequestDisbursementResponse{}
 	err := s.Process(ctx, NewRequest("VTP306", reqs, env), &results)
+	if order != nil {
+		// The outcome is recorded even when ctx is done, else the order
+		// is left SUBMITTED while Viettel may have accepted it.
+		lctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ledgerWriteTimeout)
+		defer cancel()
+
+		order.applyResponse(results, err, resubmitted)
+		if lerr := s.ledger.Update(lctx, order); lerr != nil {
+			return results, errors.Join(err, lerr)
+		}
+	}
+
 	return results, err
 }
 
-func (s *partnerAPI) QueryRequests(ctx context.Context, orderID string, query QueryRequests) ([]QueryRequestsResponse, error) {
+func (s *partnerAPI) QueryRequests(ctx context.Context, orderID string, query QueryRequests) ([]QueryRequestsResponse, BatchStatus, error) {
 	env := &QueryRequestEnvelope{}
 	env.OrderID = orderID
 	if query != nil {
@@ -225,6 +281,22 @@ func (s *partnerAPI) QueryRequests(ctx context.Context, orderID string, query Qu
 	}
 
 	results := []QueryRequestsResponse{}
-	err := s.Process(ctx, NewRequest("VTP307", nil, env), &results)
-	return results, err
+	envRes, err := s.process(ctx, NewRequest("VTP307", nil, env), &results)
+	if envRes == nil {
+		return results, BatchUnknown, err
+	}
+
+	status := ParseBatchStatus(envRes.BatchErrorCode)
+	if s.ledger != nil && status != BatchUnknown {
+		order, lerr := s.ledger.Order(ctx, orderID)
+		if lerr == nil {
+			order.applyQuery(results, status)
+			lerr = s.ledger.Update(ctx, order)
+		}
+		if lerr != nil && !errors.Is(lerr, ErrLedgerNotFound) && err == nil {
+			return results, status, lerr
+		}
+	}
+
+	return results, status, err
 }
@@ -0,0 +1,159 @@
+package viettelpay
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrUnknownBatchStatus is returned when QueryRequests succeeds without a
+// known batch status, which polling would never see change.
+var ErrUnknownBatchStatus = errors.New("viettelpay: unknown batch status")
+
+type waitOptions struct {
+	interval    time.Duration
+	maxInterval time.Duration
+	multiplier  float64
+}
+
+var defaultWaitOptions = waitOptions{
+	interval:    2 * time.Second,
+	maxInterval: 30 * time.Second,
+	multiplier:  2,
+}
+
+// A WaitOption sets options such as poll interval, backoff, etc.
+type WaitOption func(*waitOptions)
+
+// WithPollInterval is a WaitOption to set the delay before the second poll
+func WithPollInterval(d time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.interval = d
+	}
+}
+
+// WithMaxPollInterval is a WaitOption to cap the delay between polls
+func WithMaxPollInterval(d time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.maxInterval = d
+	}
+}
+
+// WithPollBackoff is a WaitOption to set the factor the delay between polls
+// grows by after each poll. A factor of 1 polls at a fixed interval.
+func WithPollBackoff(multiplier float64) WaitOption {
+	return func(o *waitOptions) {
+		o.multiplier = multiplier
+	}
+}
+
+// DisbursementUpdate is a snapshot of a disbursement batch, as returned
+// by QueryRequests.
+type DisbursementUpdate struct {
+	Results []QueryRequestsResponse
+	Status  BatchStatus
+	// Err is the error returned by QueryRequests, usually a *BatchError
+	// carrying the batch status, or ErrUnknownBatchStatus.
+	Err error
+	// Final reports whether the batch will not change anymore, or polling
+	// stopped because of an error.
+	Final bool
+}
+
+// IsBatchInProgress reports whether err is a batch status that may still
+// change, such as WAIT_DISB or DISBURSEMENT.
+func IsBatchInProgress(err error) bool {
+	return errors.Is(err, ErrBatchWaitDisb) || errors.Is(err, ErrBatchDisbursement)
+}
+
+// IsBatchFinal reports whether err is a batch status that will not change
+// anymore: DISB_SUCCESS, DISB_FAILED, CANCEL_DISB or DISB_TIMEOUT.
+func IsBatchFinal(err error) bool {
+	return errors.Is(err, ErrBatchDisbSuccess) ||
+		errors.Is(err, ErrBatchDisbFailed) ||
+		errors.Is(err, ErrBatchCancelDisb) ||
+		errors.Is(err, ErrBatchDisbTimeout)
+}
+
+// WaitForDisbursement polls QueryRequests until the batch of orderID is
+// final, and returns the per-transaction results with the final status and
+// error, like QueryRequests does. Any other error stops polling and is
+// returned as is.
+func WaitForDisbursement(ctx context.Context, api PartnerAPI, orderID string, opts ...WaitOption) ([]QueryRequestsResponse, BatchStatus, error) {
+	var last DisbursementUpdate
+	for u := range WatchDisbursement(ctx, api, orderID, opts...) {
+		last = u
+	}
+	if !last.Final {
+		return last.Results, last.Status, ctx.Err()
+	}
+
+	return last.Results, last.Status, last.Err
+}
+
+// WatchDisbursement polls QueryRequests like WaitForDisbursement, and sends
+// an update every time the batch or a transaction changes status. The last
+// update has Final set, and the channel is closed after it. When ctx is
+// done, the channel is closed without a final update.
+func WatchDisbursement(ctx context.Context, api PartnerAPI, orderID string, opts ...WaitOption) <-chan DisbursementUpdate {
+	o := defaultWaitOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ch := make(chan DisbursementUpdate)
+	go func() {
+		defer close(ch)
+
+		var lastKey string
+		interval := o.interval
+		for {
+			results, status, err := api.QueryRequests(ctx, orderID, nil)
+			if err == nil && status == BatchUnknown {
+				err = ErrUnknownBatchStatus
+			}
+			u := DisbursementUpdate{
+				Results: results,
+				Status:  status,
+				Err:     err,
+				Final:   status.IsFinal() || (err != nil && !IsBatchInProgress(err)),
+			}
+
+			if key := updateKey(u); u.Final || key != lastKey {
+				lastKey = key
+				select {
+				case ch <- u:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if u.Final {
+				return
+			}
+
+			t := time.NewTimer(interval)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return
+			}
+
+			if interval = time.Duration(float64(interval) * o.multiplier); interval > o.maxInterval {
+				interval = o.maxInterval
+			}
+		}
+	}()
+
+	return ch
+}
+
+// updateKey identifies the statuses of an update, to detect changes.
+func updateKey(u DisbursementUpdate) string {
+	key := u.Status.Code()
+	for _, r := range u.Results {
+		key += "|" + r.TransactionID + "=" + r.ErrorCode
+	}
+
+	return key
+}
@@ -0,0 +1,114 @@
+package viettelpay_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"giautm.dev/viettelpay"
+	"giautm.dev/viettelpay/emulator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func disburse(t *testing.T, opt ...emulator.Option) (*emulator.Server, viettelpay.PartnerAPI, string) {
+	t.Helper()
+
+	srv, err := emulator.NewServer(opt...)
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	api, err := srv.PartnerAPI()
+	require.NoError(t, err)
+
+	orderID := viettelpay.GenOrderID()
+	_, err = api.RequestDisbursement(context.Background(), orderID, "Test",
+		viettelpay.RequestDisbursement{
+			TransactionID: viettelpay.GenOrderID(),
+			MSISDN:        "84365233899",
+			CustomerName:  "Nguyen Van A",
+			Amount:        1000,
+		})
+	require.NoError(t, err)
+
+	return srv, api, orderID
+}
+
+func TestWaitForDisbursement(t *testing.T) {
+	_, api, orderID := disburse(t, emulator.WithPendingQueries(3))
+
+	results, status, err := viettelpay.WaitForDisbursement(context.Background(), api, orderID,
+		viettelpay.WithPollInterval(time.Millisecond))
+	assert.True(t, errors.Is(err, viettelpay.ErrBatchDisbSuccess), "got %v", err)
+	assert.Equal(t, viettelpay.BatchSucceeded, status)
+	assert.Len(t, results, 1)
+}
+
+func TestWaitForDisbursement_Cancelled(t *testing.T) {
+	srv, api, orderID := disburse(t)
+	require.NoError(t, srv.SetBatchStatus(orderID, viettelpay.ErrBatchCancelDisb.Code))
+
+	_, status, err := viettelpay.WaitForDisbursement(context.Background(), api, orderID,
+		viettelpay.WithPollInterval(time.Millisecond))
+	assert.True(t, errors.Is(err, viettelpay.ErrBatchCancelDisb), "got %v", err)
+	assert.Equal(t, viettelpay.BatchCancelled, status)
+}
+
+func TestWaitForDisbursement_Deadline(t *testing.T) {
+	_, api, orderID := disburse(t, emulator.WithPendingQueries(1000))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, _, err := viettelpay.WaitForDisbursement(ctx, api, orderID,
+		viettelpay.WithPollInterval(time.Millisecond), viettelpay.WithPollBackoff(1))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+}
+
+func TestWatchDisbursement(t *testing.T) {
+	_, api, orderID := disburse(t, emulator.WithPendingQueries(4))
+
+	var statuses []viettelpay.BatchStatus
+	for u := range viettelpay.WatchDisbursement(context.Background(), api, orderID,
+		viettelpay.WithPollInterval(time.Millisecond)) {
+		statuses = append(statuses, u.Status)
+	}
+
+	assert.Equal(t, []viettelpay.BatchStatus{
+		viettelpay.BatchPending,
+		viettelpay.BatchDisbursing,
+		viettelpay.BatchSucceeded,
+	}, statuses)
+}
+
+func TestWithBatchSuccessAsNil(t *testing.T) {
+	srv, _, orderID := disburse(t, emulator.WithPendingQueries(0))
+
+	api, err := srv.PartnerAPI(viettelpay.WithBatchSuccessAsNil())
+	require.NoError(t, err)
+
+	results, status, err := api.QueryRequests(context.Background(), orderID, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, viettelpay.BatchSucceeded, status)
+	assert.Len(t, results, 1)
+}
+
+// unknownStatusAPI answers QueryRequests without error nor batch status.
+type unknownStatusAPI struct {
+	viettelpay.PartnerAPI
+}
+
+func (unknownStatusAPI) QueryRequests(context.Context, string, viettelpay.QueryRequests) ([]viettelpay.QueryRequestsResponse, viettelpay.BatchStatus, error) {
+	return nil, viettelpay.BatchUnknown, nil
+}
+
+func TestWaitForDisbursement_UnknownStatus(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, status, err := viettelpay.WaitForDisbursement(ctx, unknownStatusAPI{}, "ORDER1",
+		viettelpay.WithPollInterval(time.Millisecond))
+	assert.True(t, errors.Is(err, viettelpay.ErrUnknownBatchStatus), "got %v", err)
+	assert.Equal(t, viettelpay.BatchUnknown, status)
+}